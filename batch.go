@@ -0,0 +1,408 @@
+package tcpx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+// ## introduction:
+// Batch carries several frames in one frame, so that they are sent and handled together.
+// Items can be packed by any marshaller and routed by messageID or url-pattern.
+/*
+   batch := tcpx.NewBatch(tcpx.JsonMarshaller{})
+   batch.Add(1, "hello")
+   batch.AddURLPattern("/user/info/", userID)
+   results, e := client.CallBatch(ctx, batch)
+*/
+// Server handles items one by one in order, replies of items are collected into one batch-reply frame.
+// Each result tells the item's status and carries replies the item made.
+// Items reporting errors by c.ReplyError, c.Error or returning them in tcpx.Handle have status BATCH_STATUS_ERROR.
+// When batch.Atomic is true, items run only if all of them can be routed, and the first failure stops the rest.
+// Items that have finished will have their rollbacks registered by `c.OnRollback()` called, in reverse order.
+//
+// batch frame:
+// messageID DEFAULT_BATCH_MESSAGEID, header 'Frame-Type: batch', 'Batch-Count' and optional 'Batch-Atomic',
+// body is the item frames packed one after another.
+// batch-reply frame:
+// messageID DEFAULT_BATCH_MESSAGEID, header 'Frame-Type: batch-reply' and 'Batch-Count',
+// body is the reply frames one after another, each has header 'Batch-Index' and 'Batch-Status'.
+// An item replying nothing still has an empty frame carrying its status.
+
+const (
+	DEFAULT_BATCH_MESSAGEID = 1395
+
+	FRAME_BATCH       = "batch"
+	FRAME_BATCH_REPLY = "batch-reply"
+
+	BATCH_STATUS_OK          = "ok"
+	BATCH_STATUS_NOT_FOUND   = "not-found"   // no handler routes the item
+	BATCH_STATUS_ABORTED     = "aborted"     // handler chain is stopped by c.Abort()
+	BATCH_STATUS_PANIC       = "panic"       // handler chain panics
+	BATCH_STATUS_ERROR       = "error"       // handler chain reports an error or replies an error frame
+	BATCH_STATUS_SKIPPED     = "skipped"     // not run because an item before failed in atomic mode
+	BATCH_STATUS_ROLLED_BACK = "rolled-back" // finished but rolled back because an item after failed in atomic mode
+)
+
+// Batch collects item frames to be sent in one batch frame.
+type Batch struct {
+	// all-or-nothing mode
+	Atomic bool
+
+	Packx *Packx
+	items [][]byte
+}
+
+// New a batch. If marshaller is nil, official jsonMarshaller is put to used.
+func NewBatch(marshaller Marshaller) *Batch {
+	return &Batch{
+		Packx: NewPackx(marshaller),
+	}
+}
+
+// Add an item routed by messageID.
+func (b *Batch) Add(messageID int32, src interface{}, headers ...map[string]interface{}) error {
+	buf, e := b.Packx.Pack(messageID, src, headers...)
+	if e != nil {
+		return errorx.Wrap(e)
+	}
+	b.items = append(b.items, buf)
+	return nil
+}
+
+// Add an item routed by url-pattern.
+func (b *Batch) AddURLPattern(urlPattern string, src interface{}, headers ...map[string]interface{}) error {
+	message := NewURLPatternMessage(urlPattern, src)
+	for k, v := range mergeHeaders(headers) {
+		message.Set(k, v)
+	}
+	buf, e := message.Pack(b.Packx.Marshaller)
+	if e != nil {
+		return errorx.Wrap(e)
+	}
+	b.items = append(b.items, buf)
+	return nil
+}
+
+// Len of items
+func (b *Batch) Len() int {
+	return len(b.items)
+}
+
+// Pack items into a batch frame.
+func (b *Batch) Pack(headers ...map[string]interface{}) ([]byte, error) {
+	var header = mergeHeaders(headers)
+	header[HEADER_FRAME_TYPE] = FRAME_BATCH
+	header[HEADER_BATCH_COUNT] = len(b.items)
+	if b.Atomic {
+		header[HEADER_BATCH_ATOMIC] = true
+	}
+	var body = make([]byte, 0, 1024)
+	for _, v := range b.items {
+		body = append(body, v...)
+	}
+	return PackWithMarshallerAndBody(Message{MessageID: DEFAULT_BATCH_MESSAGEID, Header: header}, body)
+}
+
+// Result of a batch item.
+type BatchResult struct {
+	Index  int
+	Status string
+	// reply frames made by the item, unpack them by packx.Unpack()
+	Replies [][]byte
+}
+
+// OK is true when the item is handled without failure.
+func (br BatchResult) OK() bool {
+	return br.Status == BATCH_STATUS_OK
+}
+
+// Err returns the first error frame the item replied, nil when there is none.
+func (br BatchResult) Err() error {
+	for _, v := range br.Replies {
+		if se := StatusErrorOf(v); se != nil {
+			return se
+		}
+	}
+	return nil
+}
+
+// Unpack a batch-reply frame into results ordered by item index.
+func UnpackBatchReply(block []byte) ([]BatchResult, error) {
+	header, e := HeaderOf(block)
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+	frameType, _, _ := headerGetString(header, HEADER_FRAME_TYPE)
+	if frameType != FRAME_BATCH_REPLY {
+		return nil, errorx.NewFromStringf("frame type want '%s' but got '%s'", FRAME_BATCH_REPLY, frameType)
+	}
+	if reason, ok, _ := headerGetString(header, HEADER_BATCH_ERROR); ok {
+		return nil, errorx.NewFromStringf("batch refused by server: %s", reason)
+	}
+	body, e := BodyBytesOf(block)
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+	frames, e := splitBatchFrames(body, header[HEADER_BATCH_COUNT])
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+
+	var results = make([]BatchResult, 0, len(frames))
+	for _, frame := range frames {
+		frameHeader, e := HeaderOf(frame)
+		if e != nil {
+			return nil, errorx.Wrap(e)
+		}
+		index, e := headerGetInt(frameHeader, HEADER_BATCH_INDEX)
+		if e != nil {
+			return nil, errorx.Wrap(e)
+		}
+		status, _, _ := headerGetString(frameHeader, HEADER_BATCH_STATUS)
+		if len(results) == 0 || results[len(results)-1].Index != index {
+			results = append(results, BatchResult{Index: index, Status: status})
+		}
+		// empty frame only carries status
+		if empty, _ := frameHeader[HEADER_BATCH_EMPTY].(bool); !empty {
+			results[len(results)-1].Replies = append(results[len(results)-1].Replies, frame)
+		}
+	}
+	return results, nil
+}
+
+// split frames packed one after another, count is the declared 'Batch-Count' and must match.
+// count is sent by peer, so it's checked against body before anything is allocated by it.
+func splitBatchFrames(body []byte, count interface{}) ([][]byte, error) {
+	want, e := intOf(count)
+	if e != nil {
+		return nil, newFrameError(ErrHeaderMalformed, e, "bad '%s'", HEADER_BATCH_COUNT)
+	}
+	// an item takes 16 bytes at least
+	if want < 0 || want > len(body)/16 {
+		return nil, newFrameError(ErrHeaderMalformed, nil, "'%s' %d is out of range [0, %d] for a body of %d bytes", HEADER_BATCH_COUNT, want, len(body)/16, len(body))
+	}
+	var frames = make([][]byte, 0, want)
+	for len(body) > 0 {
+		if len(body) < 4 {
+			return nil, newFrameError(ErrFrameTooShort, nil, "batch item %d is truncated", len(frames))
+		}
+		length := binary.BigEndian.Uint32(body[0:4])
+		if length < 12 || uint64(length)+4 > uint64(len(body)) {
+			return nil, newFrameError(ErrFrameTooShort, nil, "batch item %d declares length %d but %d bytes left", len(frames), length, len(body)-4)
+		}
+		frames = append(frames, body[:4+length])
+		body = body[4+length:]
+	}
+	if len(frames) != want {
+		return nil, newFrameError(ErrHeaderMalformed, nil, "batch declares %d items but carries %d", want, len(frames))
+	}
+	return frames, nil
+}
+
+// batch item state, set on context of an item
+type batchItem struct {
+	l         *sync.Mutex
+	replies   [][]byte
+	rollbacks []func()
+	aborted   bool
+	panicked  bool
+}
+
+func (bi *batchItem) capture(buf []byte) {
+	bi.l.Lock()
+	defer bi.l.Unlock()
+	bi.replies = append(bi.replies, buf)
+}
+
+// Register f to undo what this handler has done. It's called only when this frame is an item of an atomic batch,
+// and an item after it fails. Otherwise it's a no-op.
+func (ctx *Context) OnRollback(f func()) {
+	if ctx.batch == nil {
+		return
+	}
+	ctx.batch.l.Lock()
+	defer ctx.batch.l.Unlock()
+	ctx.batch.rollbacks = append(ctx.batch.rollbacks, f)
+}
+
+// Whether the frame handled by ctx is an item of a batch.
+func (ctx *Context) InBatch() bool {
+	return ctx.batch != nil
+}
+
+// handle a batch frame, items run in order in this goroutine.
+func handleBatch(ctx *Context, tcpx *TcpX, header map[string]interface{}) {
+	// items recover their own panics, this protects the server from bad batch frames
+	defer func() {
+		if e := recover(); e != nil {
+			Logger.Println(fmt.Sprintf("recover from batch panic %v", e))
+		}
+	}()
+	body, e := BodyBytesOf(ctx.Stream)
+	if e != nil {
+		Logger.Println(errorx.Wrap(e).Error())
+		return
+	}
+	frames, e := splitBatchFrames(body, header[HEADER_BATCH_COUNT])
+	if e != nil {
+		Logger.Println(errorx.Wrap(e).Error())
+		replyBatch(ctx, nil, map[string]interface{}{HEADER_BATCH_ERROR: e.Error()})
+		return
+	}
+	allOrNothing, _ := header[HEADER_BATCH_ATOMIC].(bool)
+
+	var items = make([]*Context, len(frames))
+	var statuses = make([]string, len(frames))
+	for i, frame := range frames {
+		items[i] = copyContext(*ctx)
+		items[i].Stream = frame
+		items[i].batch = &batchItem{l: &sync.Mutex{}}
+	}
+
+	if allOrNothing {
+		var routable = true
+		for i := range items {
+			if !tcpx.routable(items[i]) {
+				statuses[i] = BATCH_STATUS_NOT_FOUND
+				routable = false
+			}
+		}
+		if !routable {
+			for i := range statuses {
+				if statuses[i] == "" {
+					statuses[i] = BATCH_STATUS_SKIPPED
+				}
+			}
+			replyBatch(ctx, batchReplyFrames(items, statuses), nil)
+			return
+		}
+	}
+
+	for i := range items {
+		statuses[i] = runBatchItem(items[i], tcpx)
+		if !allOrNothing || statuses[i] == BATCH_STATUS_OK {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			items[j].batch.rollback()
+			items[j].batch.replies = nil
+			statuses[j] = BATCH_STATUS_ROLLED_BACK
+		}
+		for j := i + 1; j < len(items); j++ {
+			statuses[j] = BATCH_STATUS_SKIPPED
+		}
+		break
+	}
+	replyBatch(ctx, batchReplyFrames(items, statuses), nil)
+}
+
+func runBatchItem(item *Context, tcpx *TcpX) string {
+	if !tcpx.routable(item) {
+		return BATCH_STATUS_NOT_FOUND
+	}
+	handleMiddleware(item, tcpx)
+	if item.batch.panicked {
+		return BATCH_STATUS_PANIC
+	}
+	if item.batch.aborted {
+		return BATCH_STATUS_ABORTED
+	}
+	if status := item.ReplyStatus(); item.Err() != nil || (status != 0 && status != OK) {
+		return BATCH_STATUS_ERROR
+	}
+	return BATCH_STATUS_OK
+}
+
+func (bi *batchItem) rollback() {
+	bi.l.Lock()
+	rollbacks := bi.rollbacks
+	bi.l.Unlock()
+	for i := len(rollbacks) - 1; i >= 0; i-- {
+		rollbacks[i]()
+	}
+}
+
+// stamp index and status on replies of each item
+func batchReplyFrames(items []*Context, statuses []string) [][]byte {
+	var frames = make([][]byte, 0, len(items))
+	for i, item := range items {
+		var stamp = map[string]interface{}{
+			HEADER_BATCH_INDEX:  i,
+			HEADER_BATCH_STATUS: statuses[i],
+		}
+		item.batch.l.Lock()
+		replies := item.batch.replies
+		item.batch.l.Unlock()
+
+		if len(replies) == 0 {
+			messageID, _ := MessageIDOf(item.Stream)
+			stamp[HEADER_BATCH_EMPTY] = true
+			frame, e := PackWithMarshallerAndBody(Message{MessageID: messageID, Header: stamp}, nil)
+			if e != nil {
+				Logger.Println(errorx.Wrap(e).Error())
+				continue
+			}
+			frames = append(frames, frame)
+			continue
+		}
+		for _, reply := range replies {
+			frame, e := SetFrameHeader(reply, stamp)
+			if e != nil {
+				Logger.Println(errorx.Wrap(e).Error())
+				continue
+			}
+			frames = append(frames, frame)
+		}
+	}
+	return frames
+}
+
+func replyBatch(ctx *Context, frames [][]byte, header map[string]interface{}) {
+	if header == nil {
+		header = make(map[string]interface{})
+	}
+	header[HEADER_FRAME_TYPE] = FRAME_BATCH_REPLY
+	header[HEADER_BATCH_COUNT] = len(frames)
+	var body = make([]byte, 0, 1024)
+	for _, v := range frames {
+		body = append(body, v...)
+	}
+	buf, e := PackWithMarshallerAndBody(Message{
+		MessageID: DEFAULT_BATCH_MESSAGEID,
+		Header:    mergeHeaders(ctx.echoHeaders([]map[string]interface{}{header})),
+	}, body)
+	if e != nil {
+		Logger.Println(errorx.Wrap(e).Error())
+		return
+	}
+	if e := ctx.replyBuf(buf); e != nil {
+		Logger.Println(errorx.Wrap(e).Error())
+	}
+}
+
+// Whether a handler will handle ctx.Stream.
+func (tcpx *TcpX) routable(ctx *Context) bool {
+	if tcpx.OnMessage != nil {
+		return true
+	}
+	switch ctx.RouterType() {
+	case MESSAGEID:
+		messageID, e := MessageIDOf(ctx.Stream)
+		if e != nil {
+			return false
+		}
+		_, _, _, ok := tcpx.Mux.routes().messageIDRoute(ctx, messageID)
+		return ok
+	case URLPATTERN:
+		urlPattern, e := URLPatternOf(ctx.Stream)
+		if e != nil {
+			return false
+		}
+		_, _, _, ok := tcpx.Mux.routes().matchURL(urlPattern)
+		return ok
+	}
+	return false
+}
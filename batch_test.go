@@ -0,0 +1,244 @@
+package tcpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSplitBatchFrames(t *testing.T) {
+	batch := NewBatch(JsonMarshaller{})
+	batch.Add(1, "hello")
+	batch.AddURLPattern("/hello/", "world")
+	buf, e := batch.Pack()
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	body, e := BodyBytesOf(buf)
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	if frames, e := splitBatchFrames(body, 2); e != nil || len(frames) != 2 {
+		fmt.Println(fmt.Sprintf("want 2 frames but got %d, %v", len(frames), e))
+		t.Fail()
+	}
+	if _, e := splitBatchFrames(body, 3); e == nil {
+		fmt.Println("count mismatch should fail")
+		t.Fail()
+	}
+	if _, e := splitBatchFrames(body[:len(body)-1], 2); e == nil {
+		fmt.Println("truncated item should fail")
+		t.Fail()
+	}
+	// counts are checked before allocating by them
+	for _, count := range []interface{}{-1, 1 << 40, float64(-1), float64(1 << 40)} {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					fmt.Println(fmt.Sprintf("count %v panics: %v", count, p))
+					t.Fail()
+				}
+			}()
+			if _, e := splitBatchFrames(body, count); !errors.Is(e, ErrHeaderMalformed) {
+				fmt.Println(fmt.Sprintf("count %v want ErrHeaderMalformed but got %v", count, e))
+				t.Fail()
+			}
+		}()
+	}
+}
+
+func TestHandleBatch_BadCount(t *testing.T) {
+	srv := NewTcpX(JsonMarshaller{})
+	srv.AddHandler(1, func(c *Context) {
+		c.Reply(1, "pong")
+	})
+	go srv.ListenAndServe("tcp", ":7032")
+	time.Sleep(500 * time.Millisecond)
+
+	conn, e := net.Dial("tcp", "localhost:7032")
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer conn.Close()
+	for _, count := range []int64{-1, 1 << 40} {
+		buf, e := PackWithMarshaller(Message{MessageID: DEFAULT_BATCH_MESSAGEID, Header: map[string]interface{}{
+			HEADER_FRAME_TYPE:  FRAME_BATCH,
+			HEADER_BATCH_COUNT: count,
+		}}, nil)
+		if e != nil {
+			t.Fatal(e.Error())
+		}
+		if _, e := conn.Write(buf); e != nil {
+			t.Fatal(e.Error())
+		}
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		reply, e := FirstBlockOf(conn)
+		if e != nil {
+			fmt.Println(fmt.Sprintf("count %d want a batch-reply but got %v", count, e))
+			t.FailNow()
+		}
+		if _, e := UnpackBatchReply(reply); e == nil {
+			fmt.Println(fmt.Sprintf("count %d should be refused", count))
+			t.Fail()
+		}
+	}
+
+	// server still serves
+	client, e := Dial("tcp", "localhost:7032", JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+	client.Timeout = 3 * time.Second
+	var got string
+	if e := client.Call(context.Background(), 1, nil, &got); e != nil || got != "pong" {
+		fmt.Println(fmt.Sprintf("server should survive bad batch counts, got '%s', %v", got, e))
+		t.Fail()
+	}
+}
+
+func TestClient_CallBatch(t *testing.T) {
+	var rollbacks int32
+	srv := NewTcpX(JsonMarshaller{})
+	srv.AddHandler(1, func(c *Context) {
+		var n int
+		c.Bind(&n)
+		c.Reply(1, n*n)
+	})
+	srv.AddHandler(2, func(c *Context) {
+		c.Abort()
+	})
+	srv.AddHandler(3, func(c *Context) {
+		panic("batch item panics")
+	})
+	srv.AddHandler(4, func(c *Context) {
+		c.OnRollback(func() {
+			atomic.AddInt32(&rollbacks, 1)
+		})
+	})
+	srv.AddHandler(5, func(c *Context) {
+		c.ReplyError(CLIENT_ERROR, errors.New("bad request"))
+	})
+	Handle(srv, 6, func(c *Context, req *int) (*int, error) {
+		return nil, errors.New("business failure")
+	})
+	srv.Any("/square/", func(c *Context) {
+		var n int
+		c.Bind(&n)
+		c.JSONURLPattern(n * n)
+	})
+	go srv.ListenAndServe("tcp", ":7015")
+	time.Sleep(500 * time.Millisecond)
+
+	client, e := Dial("tcp", "localhost:7015", JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+
+	check := func(name string, results []BatchResult, statuses ...string) {
+		if len(results) != len(statuses) {
+			fmt.Println(fmt.Sprintf("%s: want %d results but got %d", name, len(statuses), len(results)))
+			t.Fail()
+			return
+		}
+		for i, v := range results {
+			if v.Index != i || v.Status != statuses[i] {
+				fmt.Println(fmt.Sprintf("%s: result %d want status '%s' but got %d '%s'", name, i, statuses[i], v.Index, v.Status))
+				t.Fail()
+			}
+		}
+	}
+
+	batch := NewBatch(JsonMarshaller{})
+	batch.Add(1, 3)
+	batch.Add(2, nil)
+	batch.Add(3, nil)
+	batch.Add(9, nil)
+	batch.AddURLPattern("/square/", 4)
+	results, e := client.CallBatch(context.Background(), batch)
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	check("batch", results, BATCH_STATUS_OK, BATCH_STATUS_ABORTED, BATCH_STATUS_PANIC, BATCH_STATUS_NOT_FOUND, BATCH_STATUS_OK)
+	if len(results) == 5 {
+		var square1, square2 int
+		if len(results[0].Replies) != 1 || len(results[4].Replies) != 1 {
+			t.Fatal("ok items should carry their replies")
+		}
+		client.Packx.Unpack(results[0].Replies[0], &square1)
+		client.Packx.Unpack(results[4].Replies[0], &square2)
+		if square1 != 9 || square2 != 16 {
+			fmt.Println(fmt.Sprintf("replies want 9, 16 but got %d, %d", square1, square2))
+			t.Fail()
+		}
+	}
+
+	// the third item fails, the former two roll back
+	batch = NewBatch(JsonMarshaller{})
+	batch.Atomic = true
+	batch.Add(4, nil)
+	batch.Add(1, 2)
+	batch.Add(2, nil)
+	batch.Add(4, nil)
+	results, e = client.CallBatch(context.Background(), batch)
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	check("atomic batch", results, BATCH_STATUS_ROLLED_BACK, BATCH_STATUS_ROLLED_BACK, BATCH_STATUS_ABORTED, BATCH_STATUS_SKIPPED)
+	if len(results) == 4 && len(results[1].Replies) != 0 {
+		fmt.Println("replies of rolled back item should be dropped")
+		t.Fail()
+	}
+	if n := atomic.LoadInt32(&rollbacks); n != 1 {
+		fmt.Println(fmt.Sprintf("rollbacks want 1 but got %d", n))
+		t.Fail()
+	}
+
+	// business errors are failures of items
+	batch = NewBatch(JsonMarshaller{})
+	batch.Add(5, nil)
+	batch.Add(6, 1)
+	results, e = client.CallBatch(context.Background(), batch)
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	check("error batch", results, BATCH_STATUS_ERROR, BATCH_STATUS_ERROR)
+	if len(results) == 2 && len(results[0].Replies) == 1 {
+		if se := StatusErrorOf(results[0].Replies[0]); se == nil || se.Code != CLIENT_ERROR {
+			fmt.Println(fmt.Sprintf("error item should carry its error frame but got %v", se))
+			t.Fail()
+		}
+	}
+
+	// an item returning an error rolls back the former in atomic mode
+	batch = NewBatch(JsonMarshaller{})
+	batch.Atomic = true
+	batch.Add(4, nil)
+	batch.Add(6, 1)
+	batch.Add(1, 2)
+	results, e = client.CallBatch(context.Background(), batch)
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	check("atomic error batch", results, BATCH_STATUS_ROLLED_BACK, BATCH_STATUS_ERROR, BATCH_STATUS_SKIPPED)
+	if n := atomic.LoadInt32(&rollbacks); n != 2 {
+		fmt.Println(fmt.Sprintf("rollbacks want 2 but got %d", n))
+		t.Fail()
+	}
+
+	// nothing runs when an item can't be routed
+	batch = NewBatch(JsonMarshaller{})
+	batch.Atomic = true
+	batch.Add(4, nil)
+	batch.Add(9, nil)
+	results, e = client.CallBatch(context.Background(), batch)
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	check("unroutable atomic batch", results, BATCH_STATUS_SKIPPED, BATCH_STATUS_NOT_FOUND)
+}
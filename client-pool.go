@@ -1,6 +1,8 @@
 package tcpx
 
 import (
+	"context"
+	"fmt"
 	"sync"
 )
 
@@ -57,3 +59,12 @@ func (cp *ClientPool) isOnline(username string) bool {
 	_, ok := cp.Clients[username]
 	return ok
 }
+
+// Send req to user and wait for reply, see ctx.Request.
+func (cp *ClientPool) RequestUser(goctx context.Context, username string, messageID int32, req interface{}, resp interface{}, headers ...map[string]interface{}) error {
+	ctx := cp.GetClientPool(username)
+	if ctx == nil || ctx.IsOffline() {
+		return fmt.Errorf("username '%s' not found in pool, he/she might get offine", username)
+	}
+	return ctx.Request(goctx, messageID, req, resp, headers...)
+}
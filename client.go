@@ -0,0 +1,323 @@
+package tcpx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+// ## introduction:
+// Client multiplexes many outstanding requests on one connection.
+// Each Call stamps header 'Request-ID', server's Context.Reply echoes it, and the reply is routed back to its caller
+// however many other calls are waiting:
+/*
+   conn, _ := net.Dial("tcp", "localhost:8080")
+   client := tcpx.NewClient(conn, tcpx.JsonMarshaller{})
+   defer client.Close()
+
+   ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+   defer cancel()
+   var resp Resp
+   if e := client.Call(ctx, 1, req, &resp); e != nil {
+       panic(e)
+   }
+*/
+// Frames that are not replies, like messages pushed by server, go to client.OnMessage.
+
+// returned by Call when client is closed or its connection is broken
+var ErrClientClosed = errors.New("tcpx client closed")
+
+type Client struct {
+	Conn  net.Conn
+	Packx *Packx
+
+	// Default timeout of a call whose context has no deadline. Zero means waiting until reply or cancel.
+	Timeout time.Duration
+
+	// Handle frames which are not replies of calls and have no handler set by client.Handle().
+	// It runs in its own goroutine per frame. When nil, these frames are dropped.
+	OnMessage func(c *Context)
+
+	// max byte of a frame received, zero means no limit
+	maxByte int32
+
+	wLock *sync.Mutex
+
+	calls *pendingCalls
+
+	handlers map[int32]func(c *Context)
+	hLock    *sync.RWMutex
+
+	closeOnce *sync.Once
+	closed    chan struct{}
+	err       error
+}
+
+// New a client and start reading replies from conn.
+// If marshaller is nil, official jsonMarshaller is put to used.
+func NewClient(conn net.Conn, marshaller Marshaller) *Client {
+	client := &Client{
+		Conn:      conn,
+		Packx:     NewPackx(marshaller),
+		wLock:     &sync.Mutex{},
+		calls:     newPendingCalls(),
+		handlers:  make(map[int32]func(c *Context)),
+		hLock:     &sync.RWMutex{},
+		closeOnce: &sync.Once{},
+		closed:    make(chan struct{}),
+	}
+	go client.readLoop()
+	return client
+}
+
+// Dial a tcp server and new a client on the connection.
+func Dial(network string, addr string, marshaller Marshaller) (*Client, error) {
+	conn, e := net.Dial(network, addr)
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+	return NewClient(conn, marshaller), nil
+}
+
+// Limit size of frames received.
+func (client *Client) SetMaxBytePerMessage(maxByte int32) {
+	atomic.StoreInt32(&client.maxByte, maxByte)
+}
+
+// Call sends req routed by messageID and waits for its reply, which is unmarshalled into resp.
+// resp can be nil when caller doesn't care about reply body.
+// When server replies an error frame, it returns *StatusError.
+// It returns ctx.Err() when ctx is done before reply, a late reply will be dropped.
+func (client *Client) Call(ctx context.Context, messageID int32, req interface{}, resp interface{}, headers ...map[string]interface{}) error {
+	return client.call(ctx, Message{MessageID: messageID, Header: mergeHeaders(headers), Body: req}, resp)
+}
+
+// CallURLPattern is the same as Call, but routing by url-pattern.
+func (client *Client) CallURLPattern(ctx context.Context, urlPattern string, req interface{}, resp interface{}, headers ...map[string]interface{}) error {
+	message := NewURLPatternMessage(urlPattern, req)
+	for k, v := range mergeHeaders(headers) {
+		message.Set(k, v)
+	}
+	return client.call(ctx, message, resp)
+}
+
+// Send req routed by messageID without waiting for reply.
+func (client *Client) Send(messageID int32, req interface{}, headers ...map[string]interface{}) error {
+	buf, e := client.Packx.Pack(messageID, req, headers...)
+	if e != nil {
+		return errorx.Wrap(e)
+	}
+	return client.write(buf)
+}
+
+// CallBatch sends items of batch in one frame and waits for the batch-reply.
+// Results are ordered by item index, unpack replies of a result by client.Packx.Unpack().
+func (client *Client) CallBatch(ctx context.Context, batch *Batch, headers ...map[string]interface{}) ([]BatchResult, error) {
+	reply, e := client.roundTrip(ctx, func(requestID string) ([]byte, error) {
+		return batch.Pack(append(headers, map[string]interface{}{HEADER_REQUEST_ID: requestID})...)
+	})
+	if e != nil {
+		return nil, e
+	}
+	return UnpackBatchReply(reply)
+}
+
+func (client *Client) call(ctx context.Context, message Message, resp interface{}) error {
+	if message.Header == nil {
+		message.Header = make(map[string]interface{})
+	}
+	reply, e := client.roundTrip(ctx, func(requestID string) ([]byte, error) {
+		message.Header[HEADER_REQUEST_ID] = requestID
+		return message.Pack(client.Packx.Marshaller)
+	})
+	if e != nil {
+		return e
+	}
+	if se := StatusErrorOf(reply); se != nil {
+		return se
+	}
+	if resp == nil {
+		return nil
+	}
+	if _, e := client.Packx.Unpack(reply, resp); e != nil {
+		return errorx.Wrap(e)
+	}
+	return nil
+}
+
+// write the frame packed with a new request id and wait for its reply.
+func (client *Client) roundTrip(ctx context.Context, pack func(requestID string) ([]byte, error)) ([]byte, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok && client.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, client.Timeout)
+		defer cancel()
+	}
+
+	requestID, replyCh := client.calls.add()
+	defer client.calls.remove(requestID)
+
+	buf, e := pack(requestID)
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+
+	if e := client.write(buf); e != nil {
+		return nil, e
+	}
+
+	select {
+	case reply := <-replyCh:
+		return reply, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-client.closed:
+		return nil, client.err
+	}
+}
+
+func (client *Client) write(buf []byte) error {
+	select {
+	case <-client.closed:
+		return client.err
+	default:
+	}
+	client.wLock.Lock()
+	defer client.wLock.Unlock()
+	if e := WriteConn(buf, client.Conn); e != nil {
+		return errorx.Wrap(e)
+	}
+	return nil
+}
+
+func (client *Client) readLoop() {
+	for {
+		block, e := FirstBlockOfLimitMaxByte(client.Conn, atomic.LoadInt32(&client.maxByte))
+		if e != nil {
+			if e == io.EOF {
+				client.shutdown(ErrClientClosed)
+			} else {
+				client.shutdown(e)
+			}
+			return
+		}
+
+		header, e := HeaderOf(block)
+		if e != nil {
+			Logger.Println(errorx.Wrap(e).Error())
+			continue
+		}
+
+		if client.calls.deliver(header, block) {
+			continue
+		}
+
+		messageID, _ := MessageIDOf(block)
+		client.hLock.RLock()
+		handler, ok := client.handlers[messageID]
+		client.hLock.RUnlock()
+		if !ok {
+			handler = client.OnMessage
+		}
+		if handler != nil {
+			ctx := NewContext(clientConn{Conn: client.Conn, client: client}, client.Packx.Marshaller)
+			ctx.Stream = block
+			go handler(ctx)
+		}
+	}
+}
+
+// Handle frames of messageID pushed or requested by server.
+// When server calls `ctx.Request()`, handler should reply by `c.Reply()`, which echoes the request id.
+func (client *Client) Handle(messageID int32, handler func(c *Context)) {
+	client.hLock.Lock()
+	defer client.hLock.Unlock()
+	client.handlers[messageID] = handler
+}
+
+// clientConn makes replies of client handlers share the write lock with calls.
+type clientConn struct {
+	net.Conn
+	client *Client
+}
+
+func (cc clientConn) Write(buf []byte) (int, error) {
+	cc.client.wLock.Lock()
+	defer cc.client.wLock.Unlock()
+	return cc.Conn.Write(buf)
+}
+
+func (client *Client) shutdown(e error) {
+	client.closeOnce.Do(func() {
+		client.err = e
+		close(client.closed)
+	})
+}
+
+// Close the client and its connection, waiting calls return ErrClientClosed.
+func (client *Client) Close() error {
+	client.shutdown(ErrClientClosed)
+	return client.Conn.Close()
+}
+
+// Calls waiting for replies on a connection.
+// Client uses it for Call, server uses it for ctx.Request, each side numbers its own request ids.
+type pendingCalls struct {
+	seed    int64
+	l       *sync.Mutex
+	waiting map[string]chan []byte
+}
+
+func newPendingCalls() *pendingCalls {
+	return &pendingCalls{
+		l:       &sync.Mutex{},
+		waiting: make(map[string]chan []byte),
+	}
+}
+
+// add a waiting call, returns its request id and the channel its reply will be sent to.
+func (pc *pendingCalls) add() (string, chan []byte) {
+	requestID := strconv.FormatInt(atomic.AddInt64(&pc.seed, 1), 10)
+	var replyCh = make(chan []byte, 1)
+	pc.l.Lock()
+	defer pc.l.Unlock()
+	pc.waiting[requestID] = replyCh
+	return requestID, replyCh
+}
+
+func (pc *pendingCalls) remove(requestID string) {
+	pc.l.Lock()
+	defer pc.l.Unlock()
+	delete(pc.waiting, requestID)
+}
+
+// deliver block to its waiting call, returns false when block is not a reply.
+// Replies of no waiting call, like late replies of timed out calls, are dropped and should not go to handlers.
+func (pc *pendingCalls) deliver(header map[string]interface{}, block []byte) bool {
+	if isReply, _ := header[HEADER_IS_REPLY].(bool); !isReply {
+		return false
+	}
+	requestID, _, _ := headerGetString(header, HEADER_REQUEST_ID)
+	pc.l.Lock()
+	replyCh, ok := pc.waiting[requestID]
+	pc.l.Unlock()
+	if !ok {
+		Logger.Println(errorx.NewFromStringf("reply of request '%s' matches no waiting call, dropped", requestID).Error())
+		return true
+	}
+	// a duplicated reply should not block reading
+	select {
+	case replyCh <- block:
+	default:
+	}
+	return true
+}
@@ -0,0 +1,214 @@
+package tcpx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func startClientTestServer(t *testing.T, addr string) {
+	srv := NewTcpX(JsonMarshaller{})
+	// replies arrive in reverse order of requests
+	srv.AddHandler(1, func(c *Context) {
+		var n int
+		c.Bind(&n)
+		time.Sleep(time.Duration(20-n) * 20 * time.Millisecond)
+		c.Reply(2, n*n)
+	})
+	// never replies
+	srv.AddHandler(3, func(c *Context) {})
+	srv.Any("/square/", func(c *Context) {
+		var n int
+		c.Bind(&n)
+		c.JSONURLPattern(n * n)
+	})
+	go srv.ListenAndServe("tcp", addr)
+	time.Sleep(500 * time.Millisecond)
+}
+
+func TestClient_Call(t *testing.T) {
+	startClientTestServer(t, ":7012")
+
+	client, e := Dial("tcp", "localhost:7012", JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var resp int
+			if e := client.Call(context.Background(), 1, i, &resp); e != nil {
+				fmt.Println(e.Error())
+				t.Fail()
+				return
+			}
+			if resp != i*i {
+				fmt.Println(fmt.Sprintf("call %d want %d but got %d", i, i*i, resp))
+				t.Fail()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var resp int
+	if e := client.CallURLPattern(context.Background(), "/square/", 7, &resp); e != nil || resp != 49 {
+		fmt.Println(fmt.Sprintf("call url-pattern want 49 but got %d, %v", resp, e))
+		t.Fail()
+	}
+}
+
+func TestClient_CallTimeout(t *testing.T) {
+	startClientTestServer(t, ":7013")
+
+	client, e := Dial("tcp", "localhost:7013", JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if e := client.Call(ctx, 3, "hello", nil); e != context.DeadlineExceeded {
+		fmt.Println(fmt.Sprintf("call want DeadlineExceeded but got %v", e))
+		t.Fail()
+	}
+
+	client.Timeout = 200 * time.Millisecond
+	if e := client.Call(context.Background(), 3, "hello", nil); e != context.DeadlineExceeded {
+		fmt.Println(fmt.Sprintf("call with client timeout want DeadlineExceeded but got %v", e))
+		t.Fail()
+	}
+
+	cancelCtx, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	if e := client.Call(cancelCtx, 3, "hello", nil); e != context.Canceled {
+		fmt.Println(fmt.Sprintf("call want Canceled but got %v", e))
+		t.Fail()
+	}
+
+	client.Close()
+	if e := client.Call(context.Background(), 1, 1, nil); e != ErrClientClosed {
+		fmt.Println(fmt.Sprintf("call on closed client want ErrClientClosed but got %v", e))
+		t.Fail()
+	}
+}
+
+func TestContext_Request(t *testing.T) {
+	srv := NewTcpX(JsonMarshaller{})
+	srv.WithBuiltInPool(true)
+	// asks client for its config and replies what client answered
+	srv.AddHandler(10, func(c *Context) {
+		var username string
+		c.Bind(&username)
+		c.Online(username)
+
+		var config string
+		if e := c.GetPoolRef().RequestUser(context.Background(), username, 11, "config?", &config); e != nil {
+			c.Reply(12, e.Error())
+			return
+		}
+		c.Reply(12, config)
+	})
+	// client doesn't handle messageID 13
+	srv.AddHandler(14, func(c *Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		if e := c.Request(ctx, 13, "anyone?", nil); e != context.DeadlineExceeded {
+			c.Reply(15, fmt.Sprintf("request want DeadlineExceeded but got %v", e))
+			return
+		}
+		c.Reply(15, "ok")
+	})
+	go srv.ListenAndServe("tcp", ":7014")
+	time.Sleep(500 * time.Millisecond)
+
+	client, e := Dial("tcp", "localhost:7014", JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+	client.Handle(11, func(c *Context) {
+		c.Reply(11, "version 1.0")
+	})
+
+	var config string
+	if e := client.Call(context.Background(), 10, "tcpx", &config); e != nil || config != "version 1.0" {
+		fmt.Println(fmt.Sprintf("config want 'version 1.0' but got '%s', %v", config, e))
+		t.Fail()
+	}
+
+	var result string
+	if e := client.Call(context.Background(), 14, nil, &result); e != nil || result != "ok" {
+		fmt.Println(fmt.Sprintf("result want 'ok' but got '%s', %v", result, e))
+		t.Fail()
+	}
+}
+
+func TestLateReply_Dropped(t *testing.T) {
+	var serverHandled, clientHandled int32
+	srv := NewTcpX(JsonMarshaller{})
+	// requests client, which replies after the request times out
+	srv.AddHandler(20, func(c *Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		if e := c.Request(ctx, 21, nil, nil); e != context.DeadlineExceeded {
+			c.Reply(22, fmt.Sprintf("request want DeadlineExceeded but got %v", e))
+			return
+		}
+		c.Reply(22, "ok")
+	})
+	// a late reply of client should not come here
+	srv.AddHandler(21, func(c *Context) {
+		atomic.AddInt32(&serverHandled, 1)
+	})
+	// replies after client's call times out
+	srv.AddHandler(23, func(c *Context) {
+		time.Sleep(300 * time.Millisecond)
+		c.Reply(24, "late")
+	})
+	go srv.ListenAndServe("tcp", ":7030")
+	time.Sleep(500 * time.Millisecond)
+
+	client, e := Dial("tcp", "localhost:7030", JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+	client.Handle(21, func(c *Context) {
+		time.Sleep(300 * time.Millisecond)
+		c.Reply(21, "late")
+	})
+	// a late reply of server should not come here
+	client.Handle(24, func(c *Context) {
+		atomic.AddInt32(&clientHandled, 1)
+	})
+
+	var result string
+	if e := client.Call(context.Background(), 20, nil, &result); e != nil || result != "ok" {
+		fmt.Println(fmt.Sprintf("result want 'ok' but got '%s', %v", result, e))
+		t.Fail()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if e := client.Call(ctx, 23, nil, nil); e != context.DeadlineExceeded {
+		fmt.Println(fmt.Sprintf("call want DeadlineExceeded but got %v", e))
+		t.Fail()
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	if n := atomic.LoadInt32(&serverHandled); n != 0 {
+		fmt.Println(fmt.Sprintf("late reply of client should be dropped but handled %d times by server", n))
+		t.Fail()
+	}
+	if n := atomic.LoadInt32(&clientHandled); n != 0 {
+		fmt.Println(fmt.Sprintf("late reply of server should be dropped but handled %d times by client", n))
+		t.Fail()
+	}
+}
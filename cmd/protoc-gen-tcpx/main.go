@@ -0,0 +1,201 @@
+// protoc-gen-tcpx generates tcpx servers and clients from service definitions of .proto files.
+//
+// Route each rpc method by option (tcpx.message_id) or (tcpx.url_pattern), defined in tcpx/options.proto of this directory:
+/*
+   syntax = "proto3";
+   package pb;
+   option go_package = "github.com/you/project/pb";
+
+   import "tcpx/options.proto";
+
+   service Greeter {
+       rpc SayHello(SayHelloRequest) returns (SayHelloReponse) {
+           option (tcpx.message_id) = 1;
+       }
+       rpc SayBye(SayByeRequest) returns (SayByeReponse) {
+           option (tcpx.url_pattern) = "/greeter/bye/";
+       }
+   }
+*/
+// Install and generate:
+/*
+   go install github.com/fwhezfwhez/tcpx/cmd/protoc-gen-tcpx
+   protoc -I . -I $GOPATH/src/github.com/fwhezfwhez/tcpx/cmd/protoc-gen-tcpx --go_out=. --tcpx_out=. greeter.proto
+*/
+// For each service, file 'greeter_tcpx.pb.go' has
+// - messageID constants like Greeter_SayHello_MessageID, and url-pattern constants like Greeter_SayBye_URLPattern
+// - interface GreeterServer, registered by RegisterGreeterServer(srv, impl, mids...) through tcpx.Handle and tcpx.HandleURLPattern
+// - GreeterClient, whose methods call server by tcpx.Client
+// Use tcpx.ProtobufMarshaller for both sides, servers also reply by the marshaller of the request.
+package main
+
+import (
+	"fmt"
+
+	"github.com/fwhezfwhez/tcpx"
+	tcpxoptions "github.com/fwhezfwhez/tcpx/cmd/protoc-gen-tcpx/tcpx"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	contextPackage = protogen.GoImportPath("context")
+	tcpxPackage    = protogen.GoImportPath("github.com/fwhezfwhez/tcpx")
+)
+
+func main() {
+	protogen.Options{}.Run(func(gen *protogen.Plugin) error {
+		for _, f := range gen.Files {
+			if !f.Generate || len(f.Services) == 0 {
+				continue
+			}
+			if e := generateFile(gen, f); e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+}
+
+// route of a method, one of messageID and urlPattern is set.
+// 0 is a valid messageID, so whether it's set is told by hasMessageID.
+type route struct {
+	messageID     int32
+	hasMessageID  bool
+	urlPattern    string
+	hasURLPattern bool
+}
+
+func routeOf(method *protogen.Method) (route, error) {
+	var r route
+	opts, ok := method.Desc.Options().(*descriptorpb.MethodOptions)
+	if ok && opts != nil {
+		if proto.HasExtension(opts, tcpxoptions.E_MessageId) {
+			r.messageID = proto.GetExtension(opts, tcpxoptions.E_MessageId).(int32)
+			r.hasMessageID = true
+		}
+		if proto.HasExtension(opts, tcpxoptions.E_UrlPattern) {
+			r.urlPattern = proto.GetExtension(opts, tcpxoptions.E_UrlPattern).(string)
+			r.hasURLPattern = true
+		}
+	}
+	switch {
+	case r.hasMessageID && r.hasURLPattern:
+		return r, fmt.Errorf("%s: set one of option (tcpx.message_id) and (tcpx.url_pattern), not both", method.Desc.FullName())
+	case !r.hasMessageID && !r.hasURLPattern:
+		return r, fmt.Errorf("%s: option (tcpx.message_id) or (tcpx.url_pattern) is required", method.Desc.FullName())
+	case r.hasURLPattern && r.urlPattern == "":
+		return r, fmt.Errorf("%s: option (tcpx.url_pattern) should not be empty", method.Desc.FullName())
+	}
+	return r, nil
+}
+
+func generateFile(gen *protogen.Plugin, file *protogen.File) error {
+	var routes = make(map[*protogen.Method]route)
+	var messageIDs = make(map[int32]string)
+	var urlPatterns = make(map[string]string)
+	for _, service := range file.Services {
+		for _, method := range service.Methods {
+			if method.Desc.IsStreamingClient() || method.Desc.IsStreamingServer() {
+				return fmt.Errorf("%s: streaming method is not supported", method.Desc.FullName())
+			}
+			r, e := routeOf(method)
+			if e != nil {
+				return e
+			}
+			name := string(method.Desc.FullName())
+			if r.hasMessageID {
+				if tcpx.IsReservedMessageID(r.messageID) {
+					return fmt.Errorf("%s: messageID %d is in [%d, %d], reserved for framework messages", name, r.messageID, tcpx.RESERVED_MESSAGEID_MIN, tcpx.RESERVED_MESSAGEID_MAX)
+				}
+				if exist, ok := messageIDs[r.messageID]; ok {
+					return fmt.Errorf("%s: messageID %d is used by %s", name, r.messageID, exist)
+				}
+				messageIDs[r.messageID] = name
+			} else {
+				if exist, ok := urlPatterns[r.urlPattern]; ok {
+					return fmt.Errorf("%s: url-pattern '%s' is used by %s", name, r.urlPattern, exist)
+				}
+				urlPatterns[r.urlPattern] = name
+			}
+			routes[method] = r
+		}
+	}
+
+	g := gen.NewGeneratedFile(file.GeneratedFilenamePrefix+"_tcpx.pb.go", file.GoImportPath)
+	g.P("// Code generated by protoc-gen-tcpx. DO NOT EDIT.")
+	g.P("// source: ", file.Desc.Path())
+	g.P()
+	g.P("package ", file.GoPackageName)
+	g.P()
+	for _, service := range file.Services {
+		generateService(g, service, routes)
+	}
+	return nil
+}
+
+func generateService(g *protogen.GeneratedFile, service *protogen.Service, routes map[*protogen.Method]route) {
+	var serverName = service.GoName + "Server"
+	var clientName = service.GoName + "Client"
+
+	// routes
+	g.P("const (")
+	for _, method := range service.Methods {
+		r := routes[method]
+		if r.hasMessageID {
+			g.P(service.GoName, "_", method.GoName, "_MessageID int32 = ", r.messageID)
+		} else {
+			g.P(service.GoName, "_", method.GoName, "_URLPattern = ", fmt.Sprintf("%q", r.urlPattern))
+		}
+	}
+	g.P(")")
+	g.P()
+
+	// server
+	g.P("// ", serverName, " is the server API for ", service.GoName, " service.")
+	g.P("// A *", g.QualifiedGoIdent(tcpxPackage.Ident("StatusError")), " returned is replied as an error frame of its code, other errors are replied as SERVER_ERROR.")
+	g.P("type ", serverName, " interface {")
+	for _, method := range service.Methods {
+		g.P(method.Comments.Leading, method.GoName, "(c *", g.QualifiedGoIdent(tcpxPackage.Ident("Context")), ", req *", g.QualifiedGoIdent(method.Input.GoIdent), ") (*", g.QualifiedGoIdent(method.Output.GoIdent), ", error)")
+	}
+	g.P("}")
+	g.P()
+	g.P("// Register", serverName, " routes methods of s, mids are self-related middlewares of each method.")
+	g.P("func Register", serverName, "(srv *", g.QualifiedGoIdent(tcpxPackage.Ident("TcpX")), ", s ", serverName, ", mids ...func(c *", g.QualifiedGoIdent(tcpxPackage.Ident("Context")), ")) {")
+	for _, method := range service.Methods {
+		if routes[method].hasMessageID {
+			g.P(g.QualifiedGoIdent(tcpxPackage.Ident("Handle")), "(srv, ", service.GoName, "_", method.GoName, "_MessageID, s.", method.GoName, ", mids...)")
+		} else {
+			g.P(g.QualifiedGoIdent(tcpxPackage.Ident("HandleURLPattern")), "(srv, ", service.GoName, "_", method.GoName, "_URLPattern, s.", method.GoName, ", mids...)")
+		}
+	}
+	g.P("}")
+	g.P()
+
+	// client
+	g.P("// ", clientName, " is the client API for ", service.GoName, " service.")
+	g.P("// Server errors are returned as *", g.QualifiedGoIdent(tcpxPackage.Ident("StatusError")), ".")
+	g.P("type ", clientName, " struct {")
+	g.P("client *", g.QualifiedGoIdent(tcpxPackage.Ident("Client")))
+	g.P("}")
+	g.P()
+	g.P("func New", clientName, "(client *", g.QualifiedGoIdent(tcpxPackage.Ident("Client")), ") *", clientName, " {")
+	g.P("return &", clientName, "{client: client}")
+	g.P("}")
+	g.P()
+	for _, method := range service.Methods {
+		g.P(method.Comments.Leading, "func (c *", clientName, ") ", method.GoName, "(ctx ", g.QualifiedGoIdent(contextPackage.Ident("Context")), ", req *", g.QualifiedGoIdent(method.Input.GoIdent), ", headers ...map[string]interface{}) (*", g.QualifiedGoIdent(method.Output.GoIdent), ", error) {")
+		g.P("resp := new(", g.QualifiedGoIdent(method.Output.GoIdent), ")")
+		if routes[method].hasMessageID {
+			g.P("if e := c.client.Call(ctx, ", service.GoName, "_", method.GoName, "_MessageID, req, resp, headers...); e != nil {")
+		} else {
+			g.P("if e := c.client.CallURLPattern(ctx, ", service.GoName, "_", method.GoName, "_URLPattern, req, resp, headers...); e != nil {")
+		}
+		g.P("return nil, e")
+		g.P("}")
+		g.P("return resp, nil")
+		g.P("}")
+		g.P()
+	}
+}
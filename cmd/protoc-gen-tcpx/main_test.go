@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	tcpxoptions "github.com/fwhezfwhez/tcpx/cmd/protoc-gen-tcpx/tcpx"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// nil messageID and urlPattern are not set
+func methodOf(name string, messageID *int32, urlPattern *string) *descriptorpb.MethodDescriptorProto {
+	opts := &descriptorpb.MethodOptions{}
+	if messageID != nil {
+		proto.SetExtension(opts, tcpxoptions.E_MessageId, *messageID)
+	}
+	if urlPattern != nil {
+		proto.SetExtension(opts, tcpxoptions.E_UrlPattern, *urlPattern)
+	}
+	return &descriptorpb.MethodDescriptorProto{
+		Name:       proto.String(name),
+		InputType:  proto.String(".pb.SayHelloRequest"),
+		OutputType: proto.String(".pb.SayHelloReponse"),
+		Options:    opts,
+	}
+}
+
+// generate greeter.proto of methods
+func generate(methods ...*descriptorpb.MethodDescriptorProto) (string, error) {
+	message := func(name string) *descriptorpb.DescriptorProto {
+		return &descriptorpb.DescriptorProto{
+			Name: proto.String(name),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("username"),
+				Number:   proto.Int32(1),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				JsonName: proto.String("username"),
+			}},
+		}
+	}
+	greeter := &descriptorpb.FileDescriptorProto{
+		Name:        proto.String("greeter.proto"),
+		Package:     proto.String("pb"),
+		Dependency:  []string{"tcpx/options.proto"},
+		Syntax:      proto.String("proto3"),
+		Options:     &descriptorpb.FileOptions{GoPackage: proto.String("github.com/fwhezfwhez/tcpx/examples/greeter/pb")},
+		MessageType: []*descriptorpb.DescriptorProto{message("SayHelloRequest"), message("SayHelloReponse")},
+		Service:     []*descriptorpb.ServiceDescriptorProto{{Name: proto.String("Greeter"), Method: methods}},
+	}
+	gen, e := protogen.Options{}.New(&pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{"greeter.proto"},
+		ProtoFile: []*descriptorpb.FileDescriptorProto{
+			protodesc.ToFileDescriptorProto(descriptorpb.File_google_protobuf_descriptor_proto),
+			protodesc.ToFileDescriptorProto(tcpxoptions.File_tcpx_options_proto),
+			greeter,
+		},
+	})
+	if e != nil {
+		return "", e
+	}
+	for _, f := range gen.Files {
+		if f.Generate {
+			if e := generateFile(gen, f); e != nil {
+				return "", e
+			}
+		}
+	}
+	resp := gen.Response()
+	if resp.Error != nil {
+		return "", errors.New(resp.GetError())
+	}
+	return resp.File[0].GetContent(), nil
+}
+
+func TestGenerateFile(t *testing.T) {
+	content, e := generate(methodOf("SayHello", proto.Int32(1), nil), methodOf("SayBye", nil, proto.String("/greeter/bye/")))
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	for _, want := range []string{
+		"Greeter_SayHello_MessageID int32 = 1",
+		`Greeter_SayBye_URLPattern        = "/greeter/bye/"`,
+		"SayHello(c *tcpx.Context, req *SayHelloRequest) (*SayHelloReponse, error)",
+		"func RegisterGreeterServer(srv *tcpx.TcpX, s GreeterServer, mids ...func(c *tcpx.Context))",
+		"tcpx.Handle(srv, Greeter_SayHello_MessageID, s.SayHello, mids...)",
+		"tcpx.HandleURLPattern(srv, Greeter_SayBye_URLPattern, s.SayBye, mids...)",
+		"c.client.Call(ctx, Greeter_SayHello_MessageID, req, resp, headers...)",
+		"c.client.CallURLPattern(ctx, Greeter_SayBye_URLPattern, req, resp, headers...)",
+	} {
+		if !strings.Contains(content, want) {
+			fmt.Println(fmt.Sprintf("generated code should contain '%s', got:\n%s", want, content))
+			t.Fail()
+		}
+	}
+
+	// 0 is a valid messageID
+	content, e = generate(methodOf("SayHello", proto.Int32(0), nil))
+	if e != nil || !strings.Contains(content, "Greeter_SayHello_MessageID int32 = 0") || !strings.Contains(content, "tcpx.Handle(srv, Greeter_SayHello_MessageID") {
+		fmt.Println(fmt.Sprintf("messageID 0 should be routed by messageID, got %v:\n%s", e, content))
+		t.Fail()
+	}
+
+	var cases = []struct {
+		name    string
+		methods []*descriptorpb.MethodDescriptorProto
+		err     string
+	}{
+		{"no route", []*descriptorpb.MethodDescriptorProto{methodOf("SayHello", nil, nil)}, "is required"},
+		{"both routes", []*descriptorpb.MethodDescriptorProto{methodOf("SayHello", proto.Int32(1), proto.String("/hello/"))}, "not both"},
+		{"duplicate messageID", []*descriptorpb.MethodDescriptorProto{methodOf("SayHello", proto.Int32(1), nil), methodOf("SayBye", proto.Int32(1), nil)}, "is used by pb.Greeter.SayHello"},
+		{"empty url-pattern", []*descriptorpb.MethodDescriptorProto{methodOf("SayHello", nil, proto.String(""))}, "should not be empty"},
+		{"reserved messageID", []*descriptorpb.MethodDescriptorProto{methodOf("SayHello", proto.Int32(1392), nil)}, "reserved for framework messages"},
+	}
+	for _, v := range cases {
+		if _, e := generate(v.methods...); e == nil || !strings.Contains(e.Error(), v.err) {
+			fmt.Println(fmt.Sprintf("%s: want error '%s' but got %v", v.name, v.err, e))
+			t.Fail()
+		}
+	}
+}
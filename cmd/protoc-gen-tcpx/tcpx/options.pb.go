@@ -0,0 +1,112 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.23.0
+// 	protoc        (unknown)
+// source: tcpx/options.proto
+
+package tcpx
+
+import (
+	proto "github.com/golang/protobuf/proto"
+	descriptor "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// This is a compile-time assertion that a sufficiently up-to-date version
+// of the legacy proto package is being used.
+const _ = proto.ProtoPackageIsVersion4
+
+var file_tcpx_options_proto_extTypes = []protoimpl.ExtensionInfo{
+	{
+		ExtendedType:  (*descriptor.MethodOptions)(nil),
+		ExtensionType: (*int32)(nil),
+		Field:         51392,
+		Name:          "tcpx.message_id",
+		Tag:           "varint,51392,opt,name=message_id",
+		Filename:      "tcpx/options.proto",
+	},
+	{
+		ExtendedType:  (*descriptor.MethodOptions)(nil),
+		ExtensionType: (*string)(nil),
+		Field:         51393,
+		Name:          "tcpx.url_pattern",
+		Tag:           "bytes,51393,opt,name=url_pattern",
+		Filename:      "tcpx/options.proto",
+	},
+}
+
+// Extension fields to descriptor.MethodOptions.
+var (
+	// optional int32 message_id = 51392;
+	E_MessageId = &file_tcpx_options_proto_extTypes[0]
+	// optional string url_pattern = 51393;
+	E_UrlPattern = &file_tcpx_options_proto_extTypes[1]
+)
+
+var File_tcpx_options_proto protoreflect.FileDescriptor
+
+var file_tcpx_options_proto_rawDesc = []byte{
+	0x0a, 0x12, 0x74, 0x63, 0x70, 0x78, 0x2f, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x12, 0x04, 0x74, 0x63, 0x70, 0x78, 0x1a, 0x20, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x64, 0x65, 0x73, 0x63,
+	0x72, 0x69, 0x70, 0x74, 0x6f, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x3a, 0x3f, 0x0a, 0x0a,
+	0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x5f, 0x69, 0x64, 0x12, 0x1e, 0x2e, 0x67, 0x6f, 0x6f,
+	0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d, 0x65, 0x74,
+	0x68, 0x6f, 0x64, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xc0, 0x91, 0x03, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x09, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x49, 0x64, 0x3a, 0x41, 0x0a,
+	0x0b, 0x75, 0x72, 0x6c, 0x5f, 0x70, 0x61, 0x74, 0x74, 0x65, 0x72, 0x6e, 0x12, 0x1e, 0x2e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d,
+	0x65, 0x74, 0x68, 0x6f, 0x64, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0xc1, 0x91, 0x03,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x75, 0x72, 0x6c, 0x50, 0x61, 0x74, 0x74, 0x65, 0x72, 0x6e,
+	0x42, 0x35, 0x5a, 0x33, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x66,
+	0x77, 0x68, 0x65, 0x7a, 0x66, 0x77, 0x68, 0x65, 0x7a, 0x2f, 0x74, 0x63, 0x70, 0x78, 0x2f, 0x63,
+	0x6d, 0x64, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x2d, 0x67, 0x65, 0x6e, 0x2d, 0x74, 0x63,
+	0x70, 0x78, 0x2f, 0x74, 0x63, 0x70, 0x78, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var file_tcpx_options_proto_goTypes = []interface{}{
+	(*descriptor.MethodOptions)(nil), // 0: google.protobuf.MethodOptions
+}
+var file_tcpx_options_proto_depIdxs = []int32{
+	0, // 0: tcpx.message_id:extendee -> google.protobuf.MethodOptions
+	0, // 1: tcpx.url_pattern:extendee -> google.protobuf.MethodOptions
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	0, // [0:2] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_tcpx_options_proto_init() }
+func file_tcpx_options_proto_init() {
+	if File_tcpx_options_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_tcpx_options_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   0,
+			NumExtensions: 2,
+			NumServices:   0,
+		},
+		GoTypes:           file_tcpx_options_proto_goTypes,
+		DependencyIndexes: file_tcpx_options_proto_depIdxs,
+		ExtensionInfos:    file_tcpx_options_proto_extTypes,
+	}.Build()
+	File_tcpx_options_proto = out.File
+	file_tcpx_options_proto_rawDesc = nil
+	file_tcpx_options_proto_goTypes = nil
+	file_tcpx_options_proto_depIdxs = nil
+}
@@ -0,0 +1,204 @@
+package tcpx
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+// ## introduction:
+// Decoder and Encoder read and write tcpx frames over any io.Reader and io.Writer, like files, pipes and net.Conn.
+// Both are buffered, so many small frames cost few syscalls.
+/*
+   enc := tcpx.NewEncoder(conn, tcpx.JsonMarshaller{})
+   enc.Encode(tcpx.Message{MessageID: 1, Body: "hello"})
+   enc.Flush()
+
+   dec := tcpx.NewDecoder(conn, tcpx.DecoderOptions{MaxBytePerMessage: 1024 * 1024})
+   for {
+       frame, e := dec.Next()
+       if e != nil {
+           break
+       }
+       ...
+   }
+*/
+
+const DEFAULT_CODEC_BUFFER_SIZE = 4096
+
+// Options of a decoder, zero values are ok.
+type DecoderOptions struct {
+	// decodes bodies whose header 'Pack-Content-Type' is not set, nil means json
+	Marshaller Marshaller
+	// max byte of a frame, zero means no limit
+	MaxBytePerMessage int32
+	// limits of header and body, see FrameLimits
+	Limits FrameLimits
+	// size of read buffer, zero means DEFAULT_CODEC_BUFFER_SIZE
+	BufferSize int
+}
+
+// Frame is a frame read by decoder.
+type Frame struct {
+	MessageID int32
+	Header    map[string]interface{}
+	// body not unmarshalled yet
+	Body []byte
+	// the whole frame, can be passed to functions like UnpackWithMarshaller
+	Raw []byte
+}
+
+// Decoder reads frames from a buffered reader. It's not safe for concurrent use.
+type Decoder struct {
+	r    *bufio.Reader
+	opts DecoderOptions
+}
+
+// New a decoder, opts is optional.
+func NewDecoder(r io.Reader, opts ...DecoderOptions) *Decoder {
+	var opt DecoderOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Marshaller == nil {
+		opt.Marshaller = JsonMarshaller{}
+	}
+	if opt.BufferSize <= 0 {
+		opt.BufferSize = DEFAULT_CODEC_BUFFER_SIZE
+	}
+	return &Decoder{
+		r:    bufio.NewReaderSize(r, opt.BufferSize),
+		opts: opt,
+	}
+}
+
+// Next reads the next frame. It returns io.EOF when reader ends between frames.
+// Frames over limits return *LimitError or *FrameError, the same as FirstBlockOfLimitMaxByte.
+func (dec *Decoder) Next() (Frame, error) {
+	raw, e := FirstBlockOfLimitMaxByte(dec.r, dec.opts.MaxBytePerMessage, dec.opts.Limits)
+	if e != nil {
+		return Frame{}, e
+	}
+	messageID, e := MessageIDOf(raw)
+	if e != nil {
+		return Frame{}, e
+	}
+	header, e := HeaderOf(raw)
+	if e != nil {
+		return Frame{}, e
+	}
+	body, e := BodyBytesOf(raw)
+	if e != nil {
+		return Frame{}, e
+	}
+	return Frame{MessageID: messageID, Header: header, Body: body, Raw: raw}, nil
+}
+
+// Decode reads the next frame and unmarshals its body into v, by the marshaller named in header 'Pack-Content-Type'.
+// When v is *Message, its MessageID and Header are filled, and the body is unmarshalled into v.Body if it's a non-nil pointer,
+// otherwise v.Body is set to the body bytes.
+func (dec *Decoder) Decode(v interface{}) error {
+	frame, e := dec.Next()
+	if e != nil {
+		return e
+	}
+	message, ok := v.(*Message)
+	if ok {
+		message.MessageID = frame.MessageID
+		message.Header = frame.Header
+		if message.Body == nil {
+			message.Body = frame.Body
+			return nil
+		}
+		v = message.Body
+	}
+	if len(frame.Body) == 0 {
+		return nil
+	}
+	marshaller, e := MarshallerOf(frame.Raw, dec.opts.Marshaller)
+	if e != nil {
+		return e
+	}
+	if e := unmarshalBody(marshaller, frame.Body, v); e != nil {
+		return newFrameError(ErrBodyDecode, e, "marshaller '%s'", marshaller.MarshalName())
+	}
+	return nil
+}
+
+// Encoder writes frames into a buffered writer. Call Flush to make sure they reach the underlying writer.
+// It's safe for concurrent use, a frame is never interleaved with others.
+type Encoder struct {
+	Marshaller Marshaller
+
+	l      *sync.Mutex
+	w      *bufio.Writer
+	prefix [16]byte
+}
+
+// New an encoder. If marshaller is nil, official jsonMarshaller is put to used.
+func NewEncoder(w io.Writer, marshaller Marshaller) *Encoder {
+	if marshaller == nil {
+		marshaller = JsonMarshaller{}
+	}
+	return &Encoder{
+		Marshaller: marshaller,
+		l:          &sync.Mutex{},
+		w:          bufio.NewWriterSize(w, DEFAULT_CODEC_BUFFER_SIZE),
+	}
+}
+
+// Encode packs message the same as PackWithMarshaller and writes it into buffer.
+func (enc *Encoder) Encode(message Message) error {
+	header, e := json.Marshal(stampPackType(message.Header, enc.Marshaller))
+	if e != nil {
+		return errorx.Wrap(e)
+	}
+	var body []byte
+	if message.Body != nil {
+		body, e = enc.Marshaller.Marshal(message.Body)
+		if e != nil {
+			return errorx.Wrap(e)
+		}
+	}
+
+	enc.l.Lock()
+	defer enc.l.Unlock()
+	binary.BigEndian.PutUint32(enc.prefix[0:4], uint32(12+len(header)+len(body)))
+	binary.BigEndian.PutUint32(enc.prefix[4:8], uint32(message.MessageID))
+	binary.BigEndian.PutUint32(enc.prefix[8:12], uint32(len(header)))
+	binary.BigEndian.PutUint32(enc.prefix[12:16], uint32(len(body)))
+	if _, e := enc.w.Write(enc.prefix[:]); e != nil {
+		return errorx.Wrap(e)
+	}
+	if _, e := enc.w.Write(header); e != nil {
+		return errorx.Wrap(e)
+	}
+	if _, e := enc.w.Write(body); e != nil {
+		return errorx.Wrap(e)
+	}
+	return nil
+}
+
+// WriteFrame writes a packed frame into buffer, like a frame from PackWithMarshaller or Frame.Raw.
+func (enc *Encoder) WriteFrame(frame []byte) error {
+	enc.l.Lock()
+	defer enc.l.Unlock()
+	if _, e := enc.w.Write(frame); e != nil {
+		return errorx.Wrap(e)
+	}
+	return nil
+}
+
+// Flush writes buffered frames to the underlying writer.
+func (enc *Encoder) Flush() error {
+	enc.l.Lock()
+	defer enc.l.Unlock()
+	if e := enc.w.Flush(); e != nil {
+		return errorx.Wrap(e)
+	}
+	return nil
+}
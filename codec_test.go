@@ -0,0 +1,113 @@
+package tcpx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncoderDecoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf, JsonMarshaller{})
+	for i := 0; i < 100; i++ {
+		if e := enc.Encode(Message{MessageID: int32(i), Header: map[string]interface{}{"index": i}, Body: i * i}); e != nil {
+			t.Fatal(e.Error())
+		}
+		if i == 0 && buf.Len() != 0 {
+			fmt.Println("frames should stay in buffer before flush")
+			t.Fail()
+		}
+	}
+	xmlFrame, _ := PackXML.Pack(100, "xml body")
+	enc.WriteFrame(xmlFrame)
+	if e := enc.Flush(); e != nil {
+		t.Fatal(e.Error())
+	}
+
+	dec := NewDecoder(&buf)
+	for i := 0; i < 100; i++ {
+		var n int
+		var message = Message{Body: &n}
+		if e := dec.Decode(&message); e != nil {
+			t.Fatal(e.Error())
+		}
+		if message.MessageID != int32(i) || n != i*i || message.Header["index"] != float64(i) {
+			fmt.Println(fmt.Sprintf("frame %d decoded as %d %v %d", i, message.MessageID, message.Header, n))
+			t.Fail()
+		}
+	}
+	// marshaller is picked by header
+	var s string
+	if e := dec.Decode(&s); e != nil || s != "xml body" {
+		fmt.Println(fmt.Sprintf("want 'xml body' but got '%s', %v", s, e))
+		t.Fail()
+	}
+	if _, e := dec.Next(); e != io.EOF {
+		fmt.Println(fmt.Sprintf("want io.EOF but got %v", e))
+		t.Fail()
+	}
+
+	// the same frames as PackWithMarshaller
+	buf.Reset()
+	enc.Encode(Message{MessageID: 1, Body: "hello"})
+	enc.Flush()
+	packed, _ := PackJSON.Pack(1, "hello")
+	if !bytes.Equal(buf.Bytes(), packed) {
+		fmt.Println(fmt.Sprintf("encoded %v but packed %v", buf.Bytes(), packed))
+		t.Fail()
+	}
+}
+
+func TestDecoder_Limit(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf, nil)
+	enc.Encode(Message{MessageID: 1, Body: "a long long body"})
+	enc.Flush()
+
+	dec := NewDecoder(&buf, DecoderOptions{MaxBytePerMessage: 16})
+	if _, e := dec.Next(); !errors.Is(e, ErrFrameTooLarge) {
+		fmt.Println(fmt.Sprintf("want ErrFrameTooLarge but got %v", e))
+		t.Fail()
+	}
+}
+
+func TestEncoderDecoder_FileAndConn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frames")
+	f, e := os.Create(path)
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	enc := NewEncoder(f, PackYAML.Marshaller)
+	enc.Encode(Message{MessageID: 1, Body: "from file"})
+	enc.Flush()
+	f.Close()
+
+	f, e = os.Open(path)
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer f.Close()
+	var s string
+	if e := NewDecoder(f).Decode(&s); e != nil || s != "from file" {
+		fmt.Println(fmt.Sprintf("want 'from file' but got '%s', %v", s, e))
+		t.Fail()
+	}
+
+	c, s2 := net.Pipe()
+	go func() {
+		enc := NewEncoder(c, nil)
+		enc.Encode(Message{MessageID: 2, Body: "from conn"})
+		enc.Flush()
+		c.Close()
+	}()
+	frame, e := NewDecoder(s2).Next()
+	if e != nil || frame.MessageID != 2 || string(frame.Body) != `"from conn"` {
+		fmt.Println(fmt.Sprintf("want frame 2 'from conn' but got %d '%s', %v", frame.MessageID, frame.Body, e))
+		t.Fail()
+	}
+}
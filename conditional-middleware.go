@@ -0,0 +1,195 @@
+package tcpx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+// ## introduction:
+// Conditional middlewares work for routes chosen by predicates, regardless of where routes are registered:
+/*
+   srv.UseWhen(tcpx.MessageIDRange(1000, 1999), "auth", auth)
+   srv.UseWhen(tcpx.URLPrefix("/admin/"), "admin", adminOnly)
+   srv.UseWhen(tcpx.HeaderPresent("Trace-ID"), "trace", trace)
+*/
+// Unlike anchor middlewares by Use/UnUse, the order of UseWhen and AddHandler doesn't matter.
+// Predicates are evaluated once for each route when routes are published, and results are cached,
+// so routing a frame only appends the cached middlewares.
+// Predicates depending on frames, like HeaderPresent, choose all routes, and check frames before running the middleware.
+//
+// Chain of a route: global -> anchor -> conditional -> self-related -> handler.
+// Conditional middlewares are disabled and enabled by key, the same as anchor middlewares: srv.DisableMiddleware("auth").
+// They don't work for srv.OnMessage and fallbacks of srv.NoRoute, srv.NoMessageID.
+
+// RouteKey identifies a route for predicates, one of MessageID and URLPattern is set.
+type RouteKey struct {
+	MessageID  int32
+	URLPattern string
+}
+
+// RoutePredicate chooses routes a middleware added by UseWhen works for.
+type RoutePredicate struct {
+	// description, listed by srv.Routes()
+	name string
+	// evaluated once for each route
+	route func(r RouteKey) bool
+	// evaluated for each frame, nil when predicate only depends on route
+	frame func(c *Context) bool
+}
+
+func (p RoutePredicate) String() string {
+	return p.name
+}
+
+// RouteWhen makes a custom predicate. f should only depend on r, since its result is cached.
+func RouteWhen(name string, f func(r RouteKey) bool) RoutePredicate {
+	return RoutePredicate{name: name, route: f}
+}
+
+// Routes of messageID in messageIDs.
+func MessageIDIn(messageIDs ...int32) RoutePredicate {
+	var set = make(map[int32]bool, len(messageIDs))
+	var names = make([]string, 0, len(messageIDs))
+	for _, v := range messageIDs {
+		set[v] = true
+		names = append(names, fmt.Sprintf("%d", v))
+	}
+	return RouteWhen(fmt.Sprintf("messageID in [%s]", strings.Join(names, ", ")), func(r RouteKey) bool {
+		return r.URLPattern == "" && set[r.MessageID]
+	})
+}
+
+// Routes of messageID in [min, max].
+func MessageIDRange(min int32, max int32) RoutePredicate {
+	if min > max {
+		panic(errorx.NewFromStringf("messageID range requires min <= max but got [%d, %d]", min, max))
+	}
+	return RouteWhen(fmt.Sprintf("messageID in range [%d, %d]", min, max), func(r RouteKey) bool {
+		return r.URLPattern == "" && r.MessageID >= min && r.MessageID <= max
+	})
+}
+
+// Routes of url-pattern starting with prefix.
+func URLPrefix(prefix string) RoutePredicate {
+	return RouteWhen(fmt.Sprintf("url-pattern prefix %s", prefix), func(r RouteKey) bool {
+		return r.URLPattern != "" && strings.HasPrefix(r.URLPattern, prefix)
+	})
+}
+
+// Frames carrying header key, of all routes.
+func HeaderPresent(key string) RoutePredicate {
+	return RoutePredicate{
+		name: fmt.Sprintf("header %s present", key),
+		route: func(r RouteKey) bool {
+			return true
+		},
+		frame: func(c *Context) bool {
+			header, e := c.streamHeader()
+			if e != nil {
+				return false
+			}
+			_, ok := header[key]
+			return ok
+		},
+	}
+}
+
+// a middleware added by UseWhen
+type whenMiddleware struct {
+	key        string
+	predicate  RoutePredicate
+	middleware func(c *Context)
+	// middleware, checking frames first when predicate depends on frames
+	handler func(c *Context)
+}
+
+// cache key of a predicate result
+type whenResultKey struct {
+	middlewareKey string
+	route         RouteKey
+}
+
+// Add a middleware working for routes chosen by predicate, middlewareKey is used to disable or enable it.
+func (tcpx *TcpX) UseWhen(predicate RoutePredicate, middlewareKey string, middleware func(c *Context)) {
+	if predicate.route == nil {
+		panic(errorx.NewFromString("tcpx.UseWhen requires a predicate made by MessageIDIn, MessageIDRange, URLPrefix, HeaderPresent or RouteWhen"))
+	}
+	if middleware == nil {
+		panic(errorx.NewFromStringf("tcpx.UseWhen(%s) requires middleware not nil", middlewareKey))
+	}
+	if tcpx.Mux == nil {
+		tcpx.Mux = NewMux()
+	}
+	wm := whenMiddleware{
+		key:        middlewareKey,
+		predicate:  predicate,
+		middleware: middleware,
+		handler:    middleware,
+	}
+	if predicate.frame != nil {
+		wm.handler = func(c *Context) {
+			if predicate.frame(c) {
+				middleware(c)
+			}
+		}
+	}
+
+	mux := tcpx.Mux
+	mux.Mutex.Lock()
+	defer mux.Mutex.Unlock()
+	if _, ok := mux.MiddlewareAnchorMap[middlewareKey]; ok || mux.hasWhenMiddleware(middlewareKey) {
+		panic(errorx.NewFromStringf("middlewareKey '%s' already exists", middlewareKey))
+	}
+	mux.whenMiddlewares = append(mux.whenMiddlewares, wm)
+	mux.publish()
+}
+
+// whether middlewareKey is added by UseWhen
+func (mux *Mux) whenMiddlewareExists(middlewareKey string) bool {
+	mux.Mutex.RLock()
+	defer mux.Mutex.RUnlock()
+	return mux.hasWhenMiddleware(middlewareKey)
+}
+
+// caller must hold mux.Mutex
+func (mux *Mux) hasWhenMiddleware(middlewareKey string) bool {
+	for _, v := range mux.whenMiddlewares {
+		if v.key == middlewareKey {
+			return true
+		}
+	}
+	return false
+}
+
+// enabled conditional middlewares of route, caller must hold mux.Mutex
+func (mux *Mux) resolveWhenMiddlewares(route RouteKey) []whenMiddleware {
+	var wms []whenMiddleware
+	for _, v := range mux.whenMiddlewares {
+		if mux.disabledMiddlewares[v.key] {
+			continue
+		}
+		k := whenResultKey{middlewareKey: v.key, route: route}
+		ok, cached := mux.whenResults[k]
+		if !cached {
+			ok = v.predicate.route(route)
+			if mux.whenResults == nil {
+				mux.whenResults = make(map[whenResultKey]bool)
+			}
+			mux.whenResults[k] = ok
+		}
+		if ok {
+			wms = append(wms, v)
+		}
+	}
+	return wms
+}
+
+// append handlers of conditional middlewares to chain
+func appendWhenHandlers(chain []func(c *Context), wms []whenMiddleware) []func(c *Context) {
+	for _, v := range wms {
+		chain = append(chain, v.handler)
+	}
+	return chain
+}
@@ -0,0 +1,114 @@
+package tcpx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTcpX_UseWhen(t *testing.T) {
+	var evaluated int32
+	srv := NewTcpX(JsonMarshaller{})
+	var mark = func(tag string) func(c *Context) {
+		return func(c *Context) {
+			tags, _ := c.GetCtxPerRequest("tags")
+			s, _ := tags.(string)
+			c.SetCtxPerRequest("tags", s+tag)
+		}
+	}
+	var reply = func(c *Context) {
+		tags, _ := c.GetCtxPerRequest("tags")
+		s, _ := tags.(string)
+		if c.RouterType() == URLPATTERN {
+			c.JSONURLPattern(s)
+			return
+		}
+		messageID, _ := MessageIDOf(c.Stream)
+		c.Reply(messageID, s)
+	}
+
+	srv.AddHandler(1, reply)
+	// added before routes registered after it, order doesn't matter
+	srv.UseWhen(MessageIDRange(1, 10), "range", mark("r"))
+	srv.UseWhen(MessageIDIn(2, 20), "in", mark("i"))
+	srv.UseWhen(URLPrefix("/admin/"), "admin", mark("a"))
+	srv.UseWhen(HeaderPresent("Trace-ID"), "trace", mark("t"))
+	srv.UseWhen(RouteWhen("counted", func(r RouteKey) bool {
+		atomic.AddInt32(&evaluated, 1)
+		return false
+	}), "counted", mark("c"))
+	srv.AddHandler(2, reply)
+	srv.AddHandler(20, mark("s"), reply)
+	srv.Any("/admin/users/", reply)
+	srv.Any("/users/", reply)
+	go srv.ListenAndServe("tcp", ":7028")
+	time.Sleep(500 * time.Millisecond)
+
+	client, e := Dial("tcp", "localhost:7028", JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+	client.Timeout = 3 * time.Second
+
+	var trace = map[string]interface{}{"Trace-ID": "x"}
+	var cases = []struct {
+		messageID  int32
+		urlPattern string
+		header     map[string]interface{}
+		want       string
+	}{
+		{1, "", nil, "r"},
+		{2, "", nil, "ri"},
+		{20, "", trace, "its"},
+		{0, "/admin/users/", nil, "a"},
+		{0, "/users/", trace, "t"},
+	}
+	for _, c := range cases {
+		var got string
+		var headers []map[string]interface{}
+		if c.header != nil {
+			headers = append(headers, c.header)
+		}
+		var e error
+		if c.urlPattern != "" {
+			e = client.CallURLPattern(context.Background(), c.urlPattern, nil, &got, headers...)
+		} else {
+			e = client.Call(context.Background(), c.messageID, nil, &got, headers...)
+		}
+		if e != nil || got != c.want {
+			fmt.Println(fmt.Sprintf("route %d '%s' want '%s' but got '%s', %v", c.messageID, c.urlPattern, c.want, got, e))
+			t.Fail()
+		}
+	}
+
+	// each route evaluated once, though routes are published many times
+	if n := atomic.LoadInt32(&evaluated); n != 5 {
+		fmt.Println(fmt.Sprintf("predicate should be evaluated once for each of 5 routes but %d times", n))
+		t.Fail()
+	}
+
+	srv.DisableMiddleware("range")
+	var got string
+	if e := client.Call(context.Background(), 2, nil, &got); e != nil || got != "i" {
+		fmt.Println(fmt.Sprintf("disabled 'range' want 'i' but got '%s', %v", got, e))
+		t.Fail()
+	}
+	srv.EnableMiddleware("range")
+
+	var chain []string
+	for _, node := range srv.Routes()[1].Chain {
+		chain = append(chain, node.Kind+":"+node.Key)
+	}
+	if strings.Join(chain, ",") != "when:range,when:in,when:trace,handler:" {
+		fmt.Println(fmt.Sprintf("routes should list conditional middlewares but got %v", chain))
+		t.Fail()
+	}
+	if e := panicOf(func() { srv.Use("range", mark("x")) }); e == nil {
+		fmt.Println("Use should reject a key added by UseWhen")
+		t.Fail()
+	}
+}
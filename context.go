@@ -1,6 +1,7 @@
 package tcpx
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/fwhezfwhez/errorx"
@@ -16,6 +17,9 @@ const CONTEXT_ONLINE = 1
 const CONTEXT_OFFLINE = 2
 const ABORT = 2019
 
+// timeout of ctx.Request whose context has no deadline
+const DEFAULT_REQUEST_TIMEOUT = 10 * time.Second
+
 // Context has two concurrently safe context:
 // PerConnectionContext is used for connection, once the connection is built ,this is connection scope.
 // PerRequestContext is used for request, when connection was built, then many requests can be sent between client and server.
@@ -67,6 +71,33 @@ type Context struct {
 	// for request scpope,Stream, offset, handlers will be copy when new request comes(same connection)
 
 	Stream []byte
+
+	// incoming streams of the connection, shared among request contexts
+	streams *streamTable
+	// reader of the stream, only set when Stream is a stream-start frame
+	streamReader *StreamReader
+
+	// requests sent by server and waiting for client's replies, shared among request contexts
+	calls *pendingCalls
+	// set when Stream is an item of a batch, replies are collected into the batch-reply
+	batch *batchItem
+	// cache of ctx.Body()
+	body interface{}
+	// params of url-pattern, got by ctx.Param()
+	params []urlParam
+	// header of headerStream, parsed once for matchers and predicates, see ctx.streamHeader()
+	header       map[string]interface{}
+	headerStream []byte
+
+	// replies of the request go through it, see ctx.SetWriter
+	writer ResponseWriter
+	// hooks run when the handler chain finishes, see ctx.After
+	afters []func(c *Context)
+	// first error of the request, see ctx.Error
+	err error
+	// status of the last frame replied, see ctx.ReplyStatus
+	replyStatus int32
+
 	// used to control middleware abort or next
 	// offset == ABORT, abort
 	// else next
@@ -89,7 +120,7 @@ func copyContext(ctx Context) *Context {
 		Addr:       ctx.Addr,
 		//UDPSession:           ctx.UDPSession,
 		PerConnectionContext: ctx.PerConnectionContext,
-		PerRequestContext:    ctx.PerConnectionContext,
+		PerRequestContext:    &sync.Map{},
 		Packx:                ctx.Packx,
 		Stream:               ctx.Stream,
 		offset:               ctx.offset,
@@ -100,6 +131,8 @@ func copyContext(ctx Context) *Context {
 		userState:            ctx.userState,
 		ConnReader:           ctx.ConnReader,
 		ConnWriter:           ctx.ConnWriter,
+		streams:              ctx.streams,
+		calls:                ctx.calls,
 	}
 }
 
@@ -176,6 +209,7 @@ func (ctx *Context) Offline() error {
 // This is used for new a context for tcp server.
 func NewContext(conn net.Conn, marshaller Marshaller) *Context {
 	var online = CONTEXT_ONLINE
+	var recvEnd = make(chan int, 1)
 	return &Context{
 		Conn:                 conn,
 		PerConnectionContext: &sync.Map{},
@@ -184,8 +218,10 @@ func NewContext(conn net.Conn, marshaller Marshaller) *Context {
 		Packx:  NewPackx(marshaller),
 		offset: -1,
 
-		recvEnd:  make(chan int, 1),
+		recvEnd:  recvEnd,
 		recvAuth: make(chan int, 1),
+		streams:  newStreamTable(recvEnd),
+		calls:    newPendingCalls(),
 
 		L:         &sync.RWMutex{},
 		userState: &online,
@@ -344,8 +380,20 @@ func (ctx *Context) SetWriteDeadline(t time.Time) error {
 	return nil
 }
 
+// Bind body of ctx.Stream into dest, by the marshaller named in header 'Pack-Content-Type', see ctx.Marshaller().
+// When it fails, the request carries 'Request-ID' and the handler chain replies nothing, an error frame of CLIENT_ERROR
+// is replied automatically when the chain finishes.
 func (ctx *Context) Bind(dest interface{}) (Message, error) {
-	return ctx.Packx.Unpack(ctx.Stream, dest)
+	marshaller, e := ctx.Marshaller()
+	if e != nil {
+		ctx.autoReplyErrorUnlessReplied(CLIENT_ERROR, e)
+		return Message{}, e
+	}
+	message, e := UnpackWithMarshaller(ctx.Stream, dest, marshaller)
+	if e != nil {
+		ctx.autoReplyErrorUnlessReplied(CLIENT_ERROR, e)
+	}
+	return message, e
 }
 
 // When context serves for tcp, set context k-v pair of PerConnectionContext.
@@ -417,11 +465,26 @@ func (ctx *Context) GetCtxPerRequest(k interface{}) (interface{}, bool) {
 	return ctx.PerRequestContext.Load(k)
 }
 
-// Reply to client using ctx's well-set Packx.Marshaller.
+// Marshaller of ctx.Stream's body.
+// It's the one registered by the name in header 'Pack-Content-Type', or ctx.Packx.Marshaller when the header is not set
+// or names an unregistered marshaller.
+// So that a server can serve clients of different marshallers on the same routes.
+func (ctx *Context) Marshaller() (Marshaller, error) {
+	if len(ctx.Stream) == 0 {
+		return ctx.Packx.Marshaller, nil
+	}
+	return MarshallerOf(ctx.Stream, ctx.Packx.Marshaller)
+}
+
+// Reply to client using the marshaller of the request, see ctx.Marshaller().
 func (ctx *Context) Reply(messageID int32, src interface{}, headers ...map[string]interface{}) error {
 	var buf []byte
 	var e error
-	buf, e = ctx.Packx.Pack(messageID, src, headers ...)
+	marshaller, e := ctx.Marshaller()
+	if e != nil {
+		marshaller = ctx.Packx.Marshaller
+	}
+	buf, e = PackWithMarshaller(Message{MessageID: messageID, Header: mergeHeaders(ctx.echoHeaders(headers)), Body: src}, marshaller)
 	if e != nil {
 		return errorx.Wrap(e)
 	}
@@ -461,10 +524,29 @@ func (ctx *Context) ProtoBuf(messageID int32, src interface{}, headers ...map[st
 	return ctx.commonReply("protobuf", messageID, src, headers...)
 }
 
+// Reply to client using msgpack marshaller.
+// Whatever ctx.Packx.Marshaller.MarshalName is 'msgpack' or not , message block will marshal its header and body by msgpack marshaller.
+func (ctx *Context) Msgpack(messageID int32, src interface{}, headers ...map[string]interface{}) error {
+	return ctx.commonReply("msgpack", messageID, src, headers...)
+}
+
+// Reply to client using cbor marshaller.
+// Whatever ctx.Packx.Marshaller.MarshalName is 'cbor' or not , message block will marshal its header and body by cbor marshaller.
+func (ctx *Context) CBOR(messageID int32, src interface{}, headers ...map[string]interface{}) error {
+	return ctx.commonReply("cbor", messageID, src, headers...)
+}
+
+// Reply to client using bson marshaller.
+// Whatever ctx.Packx.Marshaller.MarshalName is 'bson' or not , message block will marshal its header and body by bson marshaller.
+func (ctx *Context) BSON(messageID int32, src interface{}, headers ...map[string]interface{}) error {
+	return ctx.commonReply("bson", messageID, src, headers...)
+}
+
 func (ctx *Context) commonReply(marshalName string, messageID int32, src interface{}, headers ...map[string]interface{}) error {
 	var buf []byte
 	var e error
 	var marshaller Marshaller
+	headers = ctx.echoHeaders(headers)
 	if ctx.Packx.Marshaller.MarshalName() != marshalName {
 		marshaller, e = GetMarshallerByMarshalName(marshalName)
 		if e != nil {
@@ -490,7 +572,7 @@ func (ctx *Context) commonReply(marshalName string, messageID int32, src interfa
 func (ctx *Context) commonReplyWithMarshaller(marshaller Marshaller, messageID int32, src interface{}, headers ...map[string]interface{}) error {
 	var buf []byte
 	var e error
-	buf, e = NewPackx(marshaller).Pack(messageID, src, headers...)
+	buf, e = NewPackx(marshaller).Pack(messageID, src, ctx.echoHeaders(headers)...)
 	if e != nil {
 		return errorx.Wrap(e)
 	}
@@ -501,8 +583,76 @@ func (ctx *Context) commonReplyWithMarshaller(marshaller Marshaller, messageID i
 	return nil
 }
 
-// Divide to udp and tcp replying accesses.
+// header of ctx.Stream, parsed once for the same stream. The returned map is shared and should not be modified.
+func (ctx *Context) streamHeader() (map[string]interface{}, error) {
+	if ctx.headerStream != nil && sameStream(ctx.headerStream, ctx.Stream) {
+		return ctx.header, nil
+	}
+	header, e := HeaderOf(ctx.Stream)
+	if e != nil {
+		return nil, e
+	}
+	ctx.setStreamHeader(header)
+	return header, nil
+}
+
+// cache header parsed from ctx.Stream
+func (ctx *Context) setStreamHeader(header map[string]interface{}) {
+	ctx.header = header
+	ctx.headerStream = ctx.Stream
+}
+
+// whether s1 and s2 are the same slice of a frame, contents are not compared
+func sameStream(s1 []byte, s2 []byte) bool {
+	return len(s1) == len(s2) && len(s1) > 0 && &s1[0] == &s2[0]
+}
+
+// RequestID returns header 'Request-ID' of ctx.Stream, empty when sender doesn't care about reply matching.
+func (ctx *Context) RequestID() string {
+	if len(ctx.Stream) == 0 {
+		return ""
+	}
+	header, e := ctx.streamHeader()
+	if e != nil {
+		return ""
+	}
+	requestID, _, _ := headerGetString(header, HEADER_REQUEST_ID)
+	return requestID
+}
+
+// When ctx.Stream carries a request id, replies echo it and mark themselves as reply,
+// so that client can match the reply to its request.
+func (ctx *Context) echoHeaders(headers []map[string]interface{}) []map[string]interface{} {
+	requestID := ctx.RequestID()
+	if requestID == "" {
+		return headers
+	}
+	return append(headers, map[string]interface{}{
+		HEADER_REQUEST_ID: requestID,
+		HEADER_IS_REPLY:   true,
+	})
+}
+
+// Replies go through ctx's ResponseWriter, see ctx.SetWriter.
 func (ctx *Context) replyBuf(buf []byte) (e error) {
+	if ctx.writer != nil {
+		return ctx.writer.WriteFrame(buf)
+	}
+	return ctx.writeFrame(buf)
+}
+
+// End of ResponseWriter, divide to udp and tcp replying accesses.
+// Replies of a batch item are collected rather than written.
+func (ctx *Context) writeFrame(buf []byte) error {
+	ctx.recordReplyStatus(buf)
+	if ctx.batch != nil {
+		ctx.batch.capture(buf)
+		return nil
+	}
+	return ctx.writeBuf(buf)
+}
+
+func (ctx *Context) writeBuf(buf []byte) (e error) {
 	switch ctx.ConnectionProtocolType() {
 	case "tcp":
 		if _, e = ctx.Conn.Write(buf); e != nil {
@@ -551,6 +701,9 @@ func (ctx Context) ClientIP() string {
 // stop middleware chain
 func (ctx *Context) Abort() {
 	ctx.offset = ABORT
+	if ctx.batch != nil {
+		ctx.batch.aborted = true
+	}
 }
 
 // Since middlewares are divided into 3 kinds: global, messageIDSelfRelated, anchorType,
@@ -610,6 +763,34 @@ func (ctx *Context) BindWithMarshaller(dest interface{}, marshaller Marshaller)
 	return NewPackx(marshaller).Unpack(ctx.Stream, dest)
 }
 
+// StreamReader returns reader of the stream started by ctx.Stream.
+// It's only available in handlers of a stream-start frame, see stream.go.
+// Data not read when handler chain returns will be discarded.
+func (ctx *Context) StreamReader() (*StreamReader, error) {
+	if ctx.streamReader == nil {
+		return nil, errors.New("ctx.Stream is not a stream-start frame, sender should use tcpx.NewStreamWriter")
+	}
+	return ctx.streamReader, nil
+}
+
+// StreamWriter returns a writer sending a stream to client with messageID.
+// Call Close() after all data written.
+func (ctx *Context) StreamWriter(messageID int32, chunkSize int, headers ...map[string]interface{}) *StreamWriter {
+	return NewStreamWriter(contextWriter{ctx: ctx}, messageID, chunkSize, ctx.echoHeaders(headers)...)
+}
+
+// contextWriter writes frames by ctx.replyBuf, so that each frame is written as a whole.
+type contextWriter struct {
+	ctx *Context
+}
+
+func (cw contextWriter) Write(buf []byte) (int, error) {
+	if e := cw.ctx.replyBuf(buf); e != nil {
+		return 0, e
+	}
+	return len(buf), nil
+}
+
 // ctx.Stream is well marshaled by pack tool.
 // ctx.RawStream is help to access raw stream.
 func (ctx *Context) RawStream() ([]byte, error) {
@@ -655,8 +836,61 @@ func (ctx *Context) SendToUsername(username string, messageID int32, src interfa
 
 // Send to another conn via Context.
 // Make sure called `srv.WithBuiltInPool(true)`
+// Different from Reply, request id of anotherCtx.Stream will not be echoed.
 func (ctx *Context) SendToConn(anotherCtx *Context, messageID int32, src interface{}, headers ...map[string]interface{}) error {
-	return anotherCtx.Reply(messageID, src, headers...)
+	buf, e := anotherCtx.Packx.Pack(messageID, src, headers...)
+	if e != nil {
+		return errorx.Wrap(e)
+	}
+	return anotherCtx.replyBuf(buf)
+}
+
+// Request sends req to the client of this connection and waits for its reply, which is unmarshalled into resp.
+// Client should reply by `c.Reply()`, which echoes header 'Request-ID'. resp can be nil when reply body is not cared.
+// When goctx has no deadline, DEFAULT_REQUEST_TIMEOUT is used.
+// Don't call it in OnConnect, replies are not read until OnConnect returns.
+func (ctx *Context) Request(goctx context.Context, messageID int32, req interface{}, resp interface{}, headers ...map[string]interface{}) error {
+	if ctx.calls == nil {
+		return errors.New("request requires a tcp connection context")
+	}
+	if goctx == nil {
+		goctx = context.Background()
+	}
+	if _, ok := goctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		goctx, cancel = context.WithTimeout(goctx, DEFAULT_REQUEST_TIMEOUT)
+		defer cancel()
+	}
+
+	requestID, replyCh := ctx.calls.add()
+	defer ctx.calls.remove(requestID)
+
+	buf, e := ctx.Packx.Pack(messageID, req, append(headers, map[string]interface{}{HEADER_REQUEST_ID: requestID})...)
+	if e != nil {
+		return errorx.Wrap(e)
+	}
+	// not a reply, so it goes to connection even in a batch item
+	if e := ctx.writeBuf(buf); e != nil {
+		return errorx.Wrap(e)
+	}
+
+	select {
+	case reply := <-replyCh:
+		if se := StatusErrorOf(reply); se != nil {
+			return se
+		}
+		if resp == nil {
+			return nil
+		}
+		if _, e := ctx.Packx.Unpack(reply, resp); e != nil {
+			return errorx.Wrap(e)
+		}
+		return nil
+	case <-goctx.Done():
+		return goctx.Err()
+	case <-ctx.recvEnd:
+		return errors.New("connection closed before reply")
+	}
 }
 
 func (ctx *Context) GetPoolRef() *ClientPool {
@@ -702,7 +936,7 @@ func (ctx *Context) routerType() (string, bool) {
 		return MESSAGEID, false
 	}
 
-	header, e := HeaderOf(ctx.Stream)
+	header, e := ctx.streamHeader()
 	if e != nil {
 		Logger.Println("header decode err: %s", errorx.Wrap(e).Error())
 		return MESSAGEID, false
@@ -735,7 +969,13 @@ func (ctx *Context) JSONURLPattern(src interface{}) error {
 	if e != nil {
 		return errorx.Wrap(e)
 	}
-	buf, e := NewURLPatternMessage(urlPattern, src).Pack(JsonMarshaller{})
+	message := NewURLPatternMessage(urlPattern, src)
+	for _, header := range ctx.echoHeaders(nil) {
+		for k, v := range header {
+			message.Set(k, v)
+		}
+	}
+	buf, e := message.Pack(JsonMarshaller{})
 	if e != nil {
 		return errorx.Wrap(e)
 	}
@@ -752,7 +992,13 @@ func (ctx *Context) ProtobufURLPattern(src interface{}) error {
 	if e != nil {
 		return errorx.Wrap(e)
 	}
-	buf, e := NewURLPatternMessage(urlPattern, src).Pack(ProtobufMarshaller{})
+	message := NewURLPatternMessage(urlPattern, src)
+	for _, header := range ctx.echoHeaders(nil) {
+		for k, v := range header {
+			message.Set(k, v)
+		}
+	}
+	buf, e := message.Pack(ProtobufMarshaller{})
 	if e != nil {
 		return errorx.Wrap(e)
 	}
@@ -0,0 +1,147 @@
+package tcpx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+// ## introduction:
+// Error frame tells client a request fails, so that client won't wait for a reply that will never come.
+// Handlers reply it by `c.ReplyError(tcpx.CLIENT_ERROR, e)`, and server replies it automatically when
+// - no handler routes the request, code NOT_FOUND
+// - c.Bind fails decoding the body and the handler chain replies nothing, code CLIENT_ERROR
+// - handler chain panics, code SERVER_ERROR, whose message is 'internal server error' and the panic is not replied
+// Automatic error frames are only sent for requests carrying header 'Request-ID', which means caller is waiting.
+// tcpx.Client returns them as *StatusError:
+/*
+   e := client.Call(ctx, 1, req, &resp)
+   var se *tcpx.StatusError
+   if errors.As(e, &se) && se.Code == tcpx.NOT_FOUND {
+       ...
+   }
+*/
+//
+// error frame:
+// messageID is the same as the request, header 'Frame-Type: error', 'Error-Code', 'Error-Message',
+// optional 'Error-Details', optional 'Error-Fields', and 'Request-ID' echoed. Body is empty.
+
+const FRAME_ERROR = "error"
+
+// error replied for panics and errors not meant for clients, like a database error,
+// the cause is recorded by ctx.Error for after hooks and logs rather than replied.
+var errInternal = errors.New("internal server error")
+
+// StatusError is the error carried by an error frame.
+type StatusError struct {
+	Code      int
+	Message   string
+	Details   string
+	MessageID int32
+	RequestID string
+	// bad fields when the request fails validation
+	Fields []FieldError
+}
+
+// New a status error, it can be replied by ctx.ReplyError to carry details.
+func NewStatusError(code int, message string, details string) *StatusError {
+	return &StatusError{Code: code, Message: message, Details: details}
+}
+
+// Is makes errors.Is(e, ErrUnknownRoute) true for NOT_FOUND replied by server.
+func (se *StatusError) Is(target error) bool {
+	return target == ErrUnknownRoute && se.Code == NOT_FOUND
+}
+
+func (se *StatusError) Error() string {
+	if se.Details == "" {
+		return fmt.Sprintf("tcpx status %d: %s", se.Code, se.Message)
+	}
+	return fmt.Sprintf("tcpx status %d: %s, %s", se.Code, se.Message, se.Details)
+}
+
+// ReplyError replies an error frame for the request of ctx.Stream, and records err by ctx.Error.
+// When err is a *StatusError, its details are replied too.
+func (ctx *Context) ReplyError(code int, err error, headers ...map[string]interface{}) error {
+	ctx.Error(err)
+	var header = mergeHeaders(ctx.echoHeaders(headers))
+	header[HEADER_FRAME_TYPE] = FRAME_ERROR
+	header[HEADER_ERROR_CODE] = code
+	if err != nil {
+		header[HEADER_ERROR_MESSAGE] = err.Error()
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		header[HEADER_ERROR_MESSAGE] = se.Message
+		if se.Details != "" {
+			header[HEADER_ERROR_DETAILS] = se.Details
+		}
+	}
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		header[HEADER_ERROR_FIELDS] = ve.Fields
+	}
+
+	var messageID int32
+	if len(ctx.Stream) != 0 {
+		messageID, _ = MessageIDOf(ctx.Stream)
+	}
+	buf, e := PackWithMarshallerAndBody(Message{MessageID: messageID, Header: header}, nil)
+	if e != nil {
+		return errorx.Wrap(e)
+	}
+	return ctx.replyBuf(buf)
+}
+
+// reply an error frame when the request is waited for by its caller
+func (ctx *Context) autoReplyError(code int, err error) {
+	ctx.Error(err)
+	if ctx.RequestID() == "" {
+		return
+	}
+	if e := ctx.ReplyError(code, err); e != nil {
+		Logger.Println(errorx.Wrap(e).Error())
+	}
+}
+
+// reply an error frame when the handler chain finishes without replying anything,
+// so that handlers replying their own errors don't reply twice.
+func (ctx *Context) autoReplyErrorUnlessReplied(code int, err error) {
+	ctx.Error(err)
+	if ctx.RequestID() == "" {
+		return
+	}
+	ctx.After(func(c *Context) {
+		if c.ReplyStatus() != 0 {
+			return
+		}
+		if e := c.ReplyError(code, err); e != nil {
+			Logger.Println(errorx.Wrap(e).Error())
+		}
+	})
+}
+
+// StatusErrorOf returns the error carried by block when block is an error frame, otherwise nil.
+func StatusErrorOf(block []byte) *StatusError {
+	header, e := HeaderOf(block)
+	if e != nil {
+		return nil
+	}
+	if frameType, _, _ := headerGetString(header, HEADER_FRAME_TYPE); frameType != FRAME_ERROR {
+		return nil
+	}
+	var se = &StatusError{}
+	se.Code, _ = headerGetInt(header, HEADER_ERROR_CODE)
+	se.Message, _, _ = headerGetString(header, HEADER_ERROR_MESSAGE)
+	se.Details, _, _ = headerGetString(header, HEADER_ERROR_DETAILS)
+	se.RequestID, _, _ = headerGetString(header, HEADER_REQUEST_ID)
+	se.MessageID, _ = MessageIDOf(block)
+	if fields, ok := header[HEADER_ERROR_FIELDS]; ok {
+		if buf, e := json.Marshal(fields); e == nil {
+			json.Unmarshal(buf, &se.Fields)
+		}
+	}
+	return se
+}
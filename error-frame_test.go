@@ -0,0 +1,103 @@
+package tcpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient_StatusError(t *testing.T) {
+	srv := NewTcpX(JsonMarshaller{})
+	srv.AddHandler(1, func(c *Context) {
+		c.ReplyError(CLIENT_ERROR, NewStatusError(CLIENT_ERROR, "bad username", "username is empty"))
+	})
+	srv.AddHandler(2, func(c *Context) {
+		var n int
+		if _, e := c.Bind(&n); e != nil {
+			return
+		}
+		c.Reply(2, n)
+	})
+	srv.AddHandler(3, func(c *Context) {
+		panic("handler panics")
+	})
+	srv.AddHandler(4, func(c *Context) {
+		c.Reply(4, "alive")
+	})
+	// replies its own error when bind fails
+	var replies int32
+	srv.AddHandler(5, func(c *Context) {
+		next := c.Writer()
+		c.SetWriter(ResponseWriterFunc(func(frame []byte) error {
+			atomic.AddInt32(&replies, 1)
+			return next.WriteFrame(frame)
+		}))
+		c.Next()
+	}, func(c *Context) {
+		var n int
+		if _, e := c.Bind(&n); e != nil {
+			c.ReplyError(NOT_AUTH, e)
+			return
+		}
+		c.Reply(5, n)
+	})
+	go srv.ListenAndServe("tcp", ":7016")
+	time.Sleep(500 * time.Millisecond)
+
+	client, e := Dial("tcp", "localhost:7016", JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+	client.Timeout = 3 * time.Second
+
+	var cases = []struct {
+		name string
+		call func() error
+		code int
+	}{
+		{"reply error", func() error { return client.Call(context.Background(), 1, nil, nil) }, CLIENT_ERROR},
+		{"decode failure", func() error { return client.Call(context.Background(), 2, "not a number", nil) }, CLIENT_ERROR},
+		{"panic", func() error { return client.Call(context.Background(), 3, nil, nil) }, SERVER_ERROR},
+		{"unknown messageID", func() error { return client.Call(context.Background(), 9, nil, nil) }, NOT_FOUND},
+		{"unknown url-pattern", func() error { return client.CallURLPattern(context.Background(), "/none/", nil, nil) }, NOT_FOUND},
+	}
+	for _, v := range cases {
+		var se *StatusError
+		if e := v.call(); !errors.As(e, &se) || se.Code != v.code {
+			fmt.Println(fmt.Sprintf("%s: want status %d but got %v", v.name, v.code, e))
+			t.Fail()
+		}
+	}
+
+	if e := client.Call(context.Background(), 9, nil, nil); !errors.Is(e, ErrUnknownRoute) {
+		fmt.Println(fmt.Sprintf("unknown route should be ErrUnknownRoute, got %v", e))
+		t.Fail()
+	}
+
+	var se *StatusError
+	if e := client.Call(context.Background(), 1, nil, nil); errors.As(e, &se) && se.Details != "username is empty" {
+		fmt.Println(fmt.Sprintf("details want 'username is empty' but got '%s'", se.Details))
+		t.Fail()
+	}
+
+	var se5 *StatusError
+	if e := client.Call(context.Background(), 5, "not a number", nil); !errors.As(e, &se5) || se5.Code != NOT_AUTH {
+		fmt.Println(fmt.Sprintf("handler's own error want status %d but got %v", NOT_AUTH, e))
+		t.Fail()
+	}
+	time.Sleep(200 * time.Millisecond)
+	if n := atomic.LoadInt32(&replies); n != 1 {
+		fmt.Println(fmt.Sprintf("bind failure replied by handler want 1 reply but got %d", n))
+		t.Fail()
+	}
+
+	var alive string
+	if e := client.Call(context.Background(), 4, nil, &alive); e != nil || alive != "alive" {
+		fmt.Println(fmt.Sprintf("server should be alive after panic, got '%s', %v", alive, e))
+		t.Fail()
+	}
+}
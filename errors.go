@@ -0,0 +1,59 @@
+package tcpx
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors of decoding frames. Decoders return *FrameError whose Kind is one of them, check by errors.Is:
+/*
+   _, e := packx.Unpack(stream, &dest)
+   if errors.Is(e, tcpx.ErrBodyDecode) {
+       ...
+   }
+*/
+// The cause, like a json syntax error, can be got by errors.As or errors.Unwrap.
+// Sizes and counts declared by peer, in the prefix or in headers like 'Batch-Count', are checked before anything is allocated by them.
+var (
+	ErrFrameTooShort     = errors.New("tcpx: frame too short")
+	ErrFrameTooLarge     = errors.New("tcpx: frame too large")
+	ErrHeaderMalformed   = errors.New("tcpx: header malformed")
+	ErrBodyDecode        = errors.New("tcpx: body decode fail")
+	ErrUnknownRoute      = errors.New("tcpx: unknown route")
+	ErrUnknownMarshaller = errors.New("tcpx: unknown marshaller")
+)
+
+// FrameError tells why a frame can't be decoded or routed.
+type FrameError struct {
+	// one of ErrFrameTooShort, ErrFrameTooLarge, ErrHeaderMalformed, ErrBodyDecode, ErrUnknownRoute, ErrUnknownMarshaller
+	Kind error
+	// what is wrong in detail
+	Msg string
+	// cause, nil when the frame itself is bad
+	Err error
+}
+
+func newFrameError(kind error, err error, format string, args ...interface{}) *FrameError {
+	return &FrameError{Kind: kind, Msg: fmt.Sprintf(format, args...), Err: err}
+}
+
+func (fe *FrameError) Error() string {
+	var s = fe.Kind.Error()
+	if fe.Msg != "" {
+		s += ", " + fe.Msg
+	}
+	if fe.Err != nil {
+		s += ": " + fe.Err.Error()
+	}
+	return s
+}
+
+// Is reports whether target is the kind of fe.
+func (fe *FrameError) Is(target error) bool {
+	return target == fe.Kind
+}
+
+// Unwrap returns the cause.
+func (fe *FrameError) Unwrap() error {
+	return fe.Err
+}
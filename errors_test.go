@@ -0,0 +1,144 @@
+package tcpx
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestUnpackWithMarshaller_Errors(t *testing.T) {
+	good, e := PackWithMarshaller(Message{MessageID: 1, Body: "hello"}, JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	var badHeader = append([]byte{}, good...)
+	badHeader[17] = '{'
+	var hugeLength = append([]byte{}, good...)
+	binary.BigEndian.PutUint32(hugeLength[0:4], 0xffffffff)
+	var hugeBody = append([]byte{}, good...)
+	binary.BigEndian.PutUint32(hugeBody[12:16], 0xfffffff0)
+	badBody, e := PackWithMarshallerAndBody(Message{MessageID: 1}, []byte("{not json"))
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	var cases = []struct {
+		name   string
+		stream []byte
+		kind   error
+	}{
+		{"empty", nil, ErrFrameTooShort},
+		{"short", good[:3], ErrFrameTooShort},
+		{"truncated", good[:len(good)-1], ErrFrameTooShort},
+		{"huge length", hugeLength, ErrFrameTooShort},
+		{"huge body length", hugeBody, ErrFrameTooShort},
+		{"bad header", badHeader, ErrHeaderMalformed},
+		{"bad body", badBody, ErrBodyDecode},
+	}
+	for _, v := range cases {
+		var dest string
+		_, e := UnpackWithMarshaller(v.stream, &dest, JsonMarshaller{})
+		if !errors.Is(e, v.kind) {
+			fmt.Println(fmt.Sprintf("%s: want %v but got %v", v.name, v.kind, e))
+			t.Fail()
+		}
+	}
+
+	var fe *FrameError
+	var syntaxErr *json.SyntaxError
+	var dest string
+	_, e = UnpackWithMarshaller(badBody, &dest, JsonMarshaller{})
+	if !errors.As(e, &fe) || !errors.As(e, &syntaxErr) {
+		fmt.Println(fmt.Sprintf("cause of body decode should be reachable, got %v", e))
+		t.Fail()
+	}
+}
+
+func TestDecoders_NoPanic(t *testing.T) {
+	good, e := PackWithMarshaller(Message{MessageID: 1, Header: map[string]interface{}{"k": "v"}, Body: "hello"}, JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	var r = rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		stream := append([]byte{}, good[:r.Intn(len(good)+1)]...)
+		for j := 0; j < r.Intn(4); j++ {
+			if len(stream) > 0 {
+				stream[r.Intn(len(stream))] = byte(r.Intn(256))
+			}
+		}
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					fmt.Println(fmt.Sprintf("decoders panic on %v: %v", stream, p))
+					t.FailNow()
+				}
+			}()
+			var dest string
+			UnpackWithMarshaller(stream, &dest, JsonMarshaller{})
+			UnpackWithMarshaller(stream, nil, JsonMarshaller{})
+			HeaderOf(stream)
+			BodyBytesOf(stream)
+			FirstBlockOfBytes(stream)
+			URLPatternOf(stream)
+		}()
+	}
+}
+
+func TestBatchDecoders_NoPanic(t *testing.T) {
+	batch := NewBatch(JsonMarshaller{})
+	batch.Add(1, "hello")
+	batch.AddURLPattern("/hello/", "world")
+	good, e := batch.Pack()
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	body, e := BodyBytesOf(good)
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	// counts are sent by peer, any of them should be an error rather than a panic
+	var counts = []interface{}{nil, "2", true, -1, 1 << 40, int64(math.MaxInt64), float64(-1), float64(1 << 40), 1e300, -1e300, 2.5, math.NaN(), math.Inf(1), math.Inf(-1)}
+	var r = rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		stream := append([]byte{}, body[:r.Intn(len(body)+1)]...)
+		for j := 0; j < r.Intn(4); j++ {
+			if len(stream) > 0 {
+				stream[r.Intn(len(stream))] = byte(r.Intn(256))
+			}
+		}
+		var count interface{} = r.Intn(4)
+		if i < len(counts) {
+			count = counts[i]
+		}
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					fmt.Println(fmt.Sprintf("batch decoders panic on count %v and %v: %v", count, stream, p))
+					t.FailNow()
+				}
+			}()
+			splitBatchFrames(stream, count)
+			reply, e := PackWithMarshallerAndBody(Message{MessageID: DEFAULT_BATCH_MESSAGEID, Header: map[string]interface{}{
+				HEADER_FRAME_TYPE:  FRAME_BATCH_REPLY,
+				HEADER_BATCH_COUNT: count,
+			}}, stream)
+			if e != nil {
+				// NaN and Inf are not json
+				return
+			}
+			UnpackBatchReply(reply)
+		}()
+	}
+	for _, count := range counts {
+		if _, e := splitBatchFrames(body, count); !errors.Is(e, ErrHeaderMalformed) {
+			fmt.Println(fmt.Sprintf("count %v want ErrHeaderMalformed but got %v", count, e))
+			t.Fail()
+		}
+	}
+}
@@ -47,7 +47,6 @@ func main() {
 		}
 		send(input, toUser, conn)
 	}
-	select {}
 }
 
 func online(username string, conn net.Conn) {
@@ -21,7 +21,6 @@ func main() {
 	conn, e := net.Dial("tcp", "localhost:7071")
 	if e != nil {
 		panic(e)
-		return
 	}
 
 	go Recv(conn)
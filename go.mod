@@ -1,19 +1,29 @@
 module github.com/fwhezfwhez/tcpx
 
-go 1.12
+go 1.20
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/fwhezfwhez/errorx v0.0.0-20200421094746-a2781b3fd382
-	github.com/gofrs/uuid v3.3.0+incompatible // indirect
+	github.com/fxamacker/cbor/v2 v2.5.0
 	github.com/golang/protobuf v1.4.2
+	github.com/rs/cors v1.7.0
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	github.com/xtaci/kcp-go v5.4.20+incompatible
+	go.mongodb.org/mongo-driver v1.17.6
+	google.golang.org/protobuf v1.23.0
+	gopkg.in/yaml.v2 v2.3.0
+)
+
+require (
+	github.com/gofrs/uuid v3.3.0+incompatible // indirect
 	github.com/klauspost/reedsolomon v1.9.9 // indirect
 	github.com/mmcloughlin/avo v0.0.0-20200523190732-4439b6b2c061 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	github.com/rs/cors v1.7.0
 	github.com/templexxx/cpufeat v0.0.0-20180724012125-cef66df7f161 // indirect
 	github.com/templexxx/xor v0.0.0-20191217153810-f85b25db303b // indirect
 	github.com/tjfoc/gmsm v1.3.1 // indirect
-	github.com/xtaci/kcp-go v5.4.20+incompatible
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 	github.com/xtaci/lossyconn v0.0.0-20200209145036-adba10fffc37 // indirect
-	gopkg.in/yaml.v2 v2.3.0
 )
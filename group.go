@@ -0,0 +1,122 @@
+package tcpx
+
+import (
+	"github.com/fwhezfwhez/errorx"
+)
+
+// ## introduction:
+// Group shares a url-pattern prefix and middlewares among routes, MessageIDGroup shares middlewares among a messageID range.
+/*
+   room := srv.Group("/game/room", auth)
+   room.Any("/join/", join)                  // /game/room/join/, auth -> join
+
+   chat := room.Group("/chat", rateLimit)
+   chat.Any("/send/", send)                  // /game/room/chat/send/, auth -> rateLimit -> send
+
+   game := srv.MessageIDGroup(1000, 1999, auth)
+   game.AddHandler(1001, join)               // auth -> join
+   game.AddHandler(2001, join)               // panics, out of range
+*/
+// Group middlewares are put before the route's own handlers when the route is registered, the same as
+// `srv.Any("/game/room/join/", auth, join)`, so they are self-related middlewares and don't depend on Use/UnUse anchors.
+// Routes registered by srv directly, or middlewares added to a group after a route is registered, are not affected.
+
+// Group of url-pattern routes.
+type Group struct {
+	srv         *TcpX
+	prefix      string
+	middlewares []func(c *Context)
+}
+
+// New a group of url-patterns starting with prefix.
+func (tcpx *TcpX) Group(prefix string, mids ...func(c *Context)) *Group {
+	return &Group{
+		srv:         tcpx,
+		prefix:      prefix,
+		middlewares: copyHandlers(mids),
+	}
+}
+
+// New a nested group, whose prefix and middlewares follow g's.
+func (g *Group) Group(prefix string, mids ...func(c *Context)) *Group {
+	return &Group{
+		srv:         g.srv,
+		prefix:      g.prefix + prefix,
+		middlewares: append(copyHandlers(g.middlewares), mids...),
+	}
+}
+
+// Add middlewares to routes registered after it.
+func (g *Group) Use(mids ...func(c *Context)) {
+	g.middlewares = append(g.middlewares, mids...)
+}
+
+// Prefix of url-patterns in the group.
+func (g *Group) Prefix() string {
+	return g.prefix
+}
+
+// Routing by url-pattern of prefix + urlPattern, the same as srv.Any.
+func (g *Group) Any(urlPattern string, handlers ...func(c *Context)) {
+	if len(handlers) <= 0 {
+		panic(errorx.NewFromStringf("handlers should more than 1 but got %d", len(handlers)))
+	}
+	g.srv.Any(g.prefix+urlPattern, append(copyHandlers(g.middlewares), handlers...)...)
+}
+
+// MessageIDGroup of messageID routes in [Min, Max].
+type MessageIDGroup struct {
+	srv         *TcpX
+	Min         int32
+	Max         int32
+	middlewares []func(c *Context)
+}
+
+// New a group of messageIDs in [min, max].
+func (tcpx *TcpX) MessageIDGroup(min int32, max int32, mids ...func(c *Context)) *MessageIDGroup {
+	if min > max {
+		panic(errorx.NewFromStringf("messageID group requires min <= max but got [%d, %d]", min, max))
+	}
+	return &MessageIDGroup{
+		srv:         tcpx,
+		Min:         min,
+		Max:         max,
+		middlewares: copyHandlers(mids),
+	}
+}
+
+// New a nested group, its range should be inside g's.
+func (g *MessageIDGroup) MessageIDGroup(min int32, max int32, mids ...func(c *Context)) *MessageIDGroup {
+	if min < g.Min || max > g.Max || min > max {
+		panic(errorx.NewFromStringf("messageID group [%d, %d] is out of its parent [%d, %d]", min, max, g.Min, g.Max))
+	}
+	return &MessageIDGroup{
+		srv:         g.srv,
+		Min:         min,
+		Max:         max,
+		middlewares: append(copyHandlers(g.middlewares), mids...),
+	}
+}
+
+// Add middlewares to routes registered after it.
+func (g *MessageIDGroup) Use(mids ...func(c *Context)) {
+	g.middlewares = append(g.middlewares, mids...)
+}
+
+// Routing by messageID, the same as srv.AddHandler. It panics when messageID is out of range.
+func (g *MessageIDGroup) AddHandler(messageID int32, handlers ...func(c *Context)) {
+	if messageID < g.Min || messageID > g.Max {
+		panic(errorx.NewFromStringf("messageID %d is out of group [%d, %d]", messageID, g.Min, g.Max))
+	}
+	if len(handlers) <= 0 {
+		panic(errorx.NewFromStringf("handlers should more than 1 but got %d", len(handlers)))
+	}
+	g.srv.AddHandler(messageID, append(copyHandlers(g.middlewares), handlers...)...)
+}
+
+// copy handlers so that appending to it never changes the origin
+func copyHandlers(handlers []func(c *Context)) []func(c *Context) {
+	var tmp = make([]func(c *Context), len(handlers))
+	copy(tmp, handlers)
+	return tmp
+}
@@ -0,0 +1,93 @@
+package tcpx
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestGroup(t *testing.T) {
+	srv := NewTcpX(JsonMarshaller{})
+	var mark = func(name string) func(c *Context) {
+		return func(c *Context) {
+			trace, _ := c.GetCtxPerRequest("trace")
+			s, _ := trace.(string)
+			c.SetCtxPerRequest("trace", s+name+",")
+		}
+	}
+	var reply = func(c *Context) {
+		trace, _ := c.GetCtxPerRequest("trace")
+		s, _ := trace.(string)
+		if c.RouterType() == URLPATTERN {
+			c.JSONURLPattern(s)
+			return
+		}
+		messageID, _ := c.Packx.MessageIDOf(c.Stream)
+		c.JSON(messageID, s)
+	}
+
+	room := srv.Group("/game/room", mark("room"))
+	room.Any("/join/", reply)
+	chat := room.Group("/chat", mark("chat"))
+	chat.Any("/send/", mark("send"), reply)
+	room.Use(mark("late"))
+	room.Any("/leave/", reply)
+
+	game := srv.MessageIDGroup(1000, 1999, mark("game"))
+	game.AddHandler(1001, reply)
+	game.MessageIDGroup(1100, 1199, mark("hall")).AddHandler(1101, reply)
+
+	for _, register := range []func(){
+		func() { game.AddHandler(2001, reply) },
+		func() { game.MessageIDGroup(900, 1100) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					fmt.Println("out of range should panic")
+					t.Fail()
+				}
+			}()
+			register()
+		}()
+	}
+
+	go srv.ListenAndServe("tcp", ":7023")
+	time.Sleep(500 * time.Millisecond)
+
+	client, e := Dial("tcp", "localhost:7023", JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+	client.Timeout = 3 * time.Second
+
+	var urls = map[string]string{
+		"/game/room/join/":      "room,",
+		"/game/room/chat/send/": "room,chat,send,",
+		"/game/room/leave/":     "room,late,",
+	}
+	for url, want := range urls {
+		var got string
+		if e := client.CallURLPattern(context.Background(), url, nil, &got); e != nil || got != want {
+			fmt.Println(fmt.Sprintf("'%s' want '%s' but got '%s', %v", url, want, got, e))
+			t.Fail()
+		}
+	}
+	var messageIDs = map[int32]string{
+		1001: "game,",
+		1101: "game,hall,",
+	}
+	for messageID, want := range messageIDs {
+		var got string
+		if e := client.Call(context.Background(), messageID, nil, &got); e != nil || got != want {
+			fmt.Println(fmt.Sprintf("messageID %d want '%s' but got '%s', %v", messageID, want, got, e))
+			t.Fail()
+		}
+	}
+	if chat.Prefix() != "/game/room/chat" {
+		fmt.Println(fmt.Sprintf("nested prefix want '/game/room/chat' but got '%s'", chat.Prefix()))
+		t.Fail()
+	}
+}
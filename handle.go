@@ -0,0 +1,127 @@
+package tcpx
+
+import (
+	"errors"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+// ## introduction:
+// Handle registers a typed handler, request is bound and response is replied by the marshaller of the connection.
+/*
+   type LoginReq struct {
+       Username string `json:"username"`
+   }
+   type LoginResp struct {
+       Token string `json:"token"`
+   }
+
+   tcpx.Handle(srv, 1, func(c *tcpx.Context, req *LoginReq) (*LoginResp, error) {
+       if req.Username == "" {
+           return nil, tcpx.NewStatusError(tcpx.CLIENT_ERROR, "bad username", "username is empty")
+       }
+       return &LoginResp{Token: "xxx"}, nil
+   })
+   tcpx.HandleURLPattern(srv, "/login/", func(c *tcpx.Context, req *LoginReq) (*LoginResp, error) {...})
+*/
+// - request fails binding or validation, error frame of CLIENT_ERROR is replied, see BindAndValidate
+// - f returns a *StatusError, error frame of its code is replied
+// - f returns other errors, error frame of SERVER_ERROR is replied with message 'internal server error', the error is kept by c.Error
+// - f returns a nil response and nil error, a frame with empty body is replied
+// Response is replied with the same messageID or url as the request.
+// mids are self-related middlewares, the same as AddHandler and Any.
+
+// Handle registers f routing by messageID.
+func Handle[Req any, Resp any](srv *TcpX, messageID int32, f func(c *Context, req *Req) (*Resp, error), mids ...func(c *Context)) {
+	srv.AddHandler(messageID, append(copyHandlers(mids), typedHandler(f, messageIDReply(messageID)))...)
+}
+
+// HandleURLPattern registers f routing by url-pattern.
+func HandleURLPattern[Req any, Resp any](srv *TcpX, urlPattern string, f func(c *Context, req *Req) (*Resp, error), mids ...func(c *Context)) {
+	srv.Any(urlPattern, append(copyHandlers(mids), typedHandler(f, urlPatternReply))...)
+}
+
+func typedHandler[Req any, Resp any](f func(c *Context, req *Req) (*Resp, error), reply func(c *Context, src interface{}) error) func(c *Context) {
+	return bindCallReply(func() interface{} {
+		return new(Req)
+	}, func(c *Context, req interface{}) (interface{}, error) {
+		resp, e := f(c, req.(*Req))
+		// a nil *Resp is replied as empty body, not as a typed nil
+		if resp == nil {
+			return nil, e
+		}
+		return resp, e
+	}, reply)
+}
+
+// handler binding a request made by newReq, calling call and replying its response by reply
+func bindCallReply(newReq func() interface{}, call func(c *Context, req interface{}) (interface{}, error), reply func(c *Context, src interface{}) error) func(c *Context) {
+	return func(c *Context) {
+		var req = newReq()
+		if _, e := c.BindAndValidate(req); e != nil {
+			// BindAndValidate replies it when the chain finishes if caller is waiting
+			if c.RequestID() == "" {
+				c.replyTypedError(CLIENT_ERROR, e)
+			}
+			return
+		}
+		resp, e := call(c, req)
+		if e != nil {
+			var se *StatusError
+			if errors.As(e, &se) {
+				c.replyTypedError(se.Code, e)
+				return
+			}
+			// e may tell internal details, it's kept for after hooks and logs but not replied
+			Logger.Println(errorx.Wrap(e).Error())
+			c.Error(e)
+			c.replyTypedError(SERVER_ERROR, errInternal)
+			return
+		}
+
+		if e := reply(c, resp); e != nil {
+			Logger.Println(errorx.Wrap(e).Error())
+		}
+	}
+}
+
+// reply with messageID
+func messageIDReply(messageID int32) func(c *Context, src interface{}) error {
+	return func(c *Context, src interface{}) error {
+		return c.Reply(messageID, src)
+	}
+}
+
+// reply with the url of the request
+func urlPatternReply(c *Context, src interface{}) error {
+	url, e := c.GetURLPattern()
+	if e != nil {
+		return errorx.Wrap(e)
+	}
+	return c.replyURLPattern(url, src)
+}
+
+func (ctx *Context) replyTypedError(code int, err error) {
+	if e := ctx.ReplyError(code, err); e != nil {
+		Logger.Println(errorx.Wrap(e).Error())
+	}
+}
+
+// reply src routing by urlPattern, using the marshaller of the request
+func (ctx *Context) replyURLPattern(urlPattern string, src interface{}) error {
+	marshaller, e := ctx.Marshaller()
+	if e != nil {
+		marshaller = ctx.Packx.Marshaller
+	}
+	message := NewURLPatternMessage(urlPattern, src)
+	for _, header := range ctx.echoHeaders(nil) {
+		for k, v := range header {
+			message.Set(k, v)
+		}
+	}
+	buf, e := message.Pack(marshaller)
+	if e != nil {
+		return errorx.Wrap(e)
+	}
+	return ctx.replyBuf(buf)
+}
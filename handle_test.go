@@ -0,0 +1,108 @@
+package tcpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type handleReq struct {
+	Username string `json:"username" msgpack:"username"`
+}
+type handleResp struct {
+	Greeting string `json:"greeting" msgpack:"greeting"`
+}
+
+func TestHandle(t *testing.T) {
+	srv := NewTcpX(JsonMarshaller{})
+	var greet = func(c *Context, req *handleReq) (*handleResp, error) {
+		switch req.Username {
+		case "":
+			return nil, NewStatusError(CLIENT_ERROR, "bad username", "username is empty")
+		case "nobody":
+			return nil, errors.New("dial tcp 10.0.0.1:3306: connection refused")
+		case "silent":
+			return nil, nil
+		}
+		return &handleResp{Greeting: "hello " + req.Username}, nil
+	}
+	var lastErr atomic.Value
+	srv.UseGlobal(func(c *Context) {
+		c.After(func(c *Context) {
+			if c.Err() != nil {
+				lastErr.Store(c.Err().Error())
+			}
+		})
+	})
+	Handle(srv, 1, greet)
+	HandleURLPattern(srv, "/greet/", greet)
+	go srv.ListenAndServe("tcp", ":7019")
+	time.Sleep(500 * time.Millisecond)
+
+	client, e := Dial("tcp", "localhost:7019", JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+	client.Timeout = 3 * time.Second
+
+	var resp handleResp
+	if e := client.Call(context.Background(), 1, handleReq{Username: "tcpx"}, &resp); e != nil || resp.Greeting != "hello tcpx" {
+		fmt.Println(fmt.Sprintf("messageID: want 'hello tcpx' but got '%s', %v", resp.Greeting, e))
+		t.Fail()
+	}
+	resp = handleResp{}
+	if e := client.CallURLPattern(context.Background(), "/greet/", handleReq{Username: "tcpx"}, &resp); e != nil || resp.Greeting != "hello tcpx" {
+		fmt.Println(fmt.Sprintf("url-pattern: want 'hello tcpx' but got '%s', %v", resp.Greeting, e))
+		t.Fail()
+	}
+	if e := client.Call(context.Background(), 1, handleReq{Username: "silent"}, nil); e != nil {
+		fmt.Println(fmt.Sprintf("nil response should reply empty body, got %v", e))
+		t.Fail()
+	}
+
+	var cases = []struct {
+		name string
+		req  interface{}
+		code int
+	}{
+		{"status error", handleReq{}, CLIENT_ERROR},
+		{"other error", handleReq{Username: "nobody"}, SERVER_ERROR},
+		{"decode failure", "not an object", CLIENT_ERROR},
+	}
+	for _, v := range cases {
+		var se *StatusError
+		if e := client.Call(context.Background(), 1, v.req, nil); !errors.As(e, &se) || se.Code != v.code {
+			fmt.Println(fmt.Sprintf("%s: want status %d but got %v", v.name, v.code, e))
+			t.Fail()
+		}
+	}
+
+	// internal errors are not replied, after hooks still see them
+	var se *StatusError
+	if e := client.Call(context.Background(), 1, handleReq{Username: "nobody"}, nil); !errors.As(e, &se) || se.Message != "internal server error" || strings.Contains(se.Error(), "10.0.0.1") {
+		fmt.Println(fmt.Sprintf("internal error should be replied as 'internal server error' but got %v", e))
+		t.Fail()
+	}
+	if got, _ := lastErr.Load().(string); !strings.Contains(got, "10.0.0.1") {
+		fmt.Println(fmt.Sprintf("after hooks should see the internal error, got '%s'", got))
+		t.Fail()
+	}
+
+	// replies by the marshaller of the request
+	msgpackClient, e := Dial("tcp", "localhost:7019", MsgpackMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer msgpackClient.Close()
+	msgpackClient.Timeout = 3 * time.Second
+	resp = handleResp{}
+	if e := msgpackClient.Call(context.Background(), 1, handleReq{Username: "msgpack"}, &resp); e != nil || resp.Greeting != "hello msgpack" {
+		fmt.Println(fmt.Sprintf("msgpack: want 'hello msgpack' but got '%s', %v", resp.Greeting, e))
+		t.Fail()
+	}
+}
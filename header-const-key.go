@@ -5,5 +5,24 @@ var (
 	HEADER_ROUTER_KEY   = "Router-Type"          // value ranged [MESSAGE_ID, URL_PATTERN]
 	HEADER_ROUTER_VALUE = "Router-Pattern-Value" // value ranged [MESSAGE_ID, URL_PATTERN]
 
-	HEADER_PACK_TYPE = "Pack-Content-Type" // value ranged [JSON, PROTOBUF, TOML, YAML, NONE]
+	HEADER_PACK_TYPE = "Pack-Content-Type" // name of body's marshaller, like json, protobuf. Stamped by PackWithMarshaller, see RegisterMarshaller
+
+	HEADER_REQUEST_ID = "Request-ID" // set by caller to match reply, Context.Reply echoes it
+	HEADER_IS_REPLY   = "Is-Reply"   // true when the frame is a reply echoing 'Request-ID'
+
+	HEADER_FRAME_TYPE   = "Frame-Type"   // value ranged [stream-start, stream-data, stream-end, batch, batch-reply, error], empty means a normal frame
+	HEADER_STREAM_ID    = "Stream-ID"    // frames of the same stream share the same stream id
+	HEADER_STREAM_ABORT = "Stream-Abort" // set on stream-end frame when sender closes the stream with an error
+
+	HEADER_BATCH_COUNT  = "Batch-Count"  // number of frames in body of a batch or batch-reply frame
+	HEADER_BATCH_ATOMIC = "Batch-Atomic" // true when items of a batch are all-or-nothing
+	HEADER_BATCH_INDEX  = "Batch-Index"  // index of the item a reply frame belongs to
+	HEADER_BATCH_STATUS = "Batch-Status" // status of the item a reply frame belongs to
+	HEADER_BATCH_EMPTY  = "Batch-Empty"  // true when the reply frame only carries status of an item replying nothing
+	HEADER_BATCH_ERROR  = "Batch-Error"  // set on batch-reply frame when the batch frame is malformed
+
+	HEADER_ERROR_CODE    = "Error-Code"    // status code of an error frame, like SERVER_ERROR
+	HEADER_ERROR_MESSAGE = "Error-Message" // message of an error frame
+	HEADER_ERROR_DETAILS = "Error-Details" // optional details of an error frame
+	HEADER_ERROR_FIELDS  = "Error-Fields"  // bad fields of an error frame replied for a *ValidationError
 )
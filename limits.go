@@ -0,0 +1,165 @@
+package tcpx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ## introduction:
+// SetMaxBytePerMessage only limits length of a whole frame. FrameLimits limits its parts separately:
+/*
+   srv.SetMaxBytePerMessage(4 * 1024 * 1024)
+   srv.WithFrameLimits(tcpx.FrameLimits{
+       MaxHeaderBytes: 4 * 1024,
+       MaxBodyBytes:   1024 * 1024,
+       MaxHeaderKeys:  32,
+       MaxHeaderDepth: 4,
+       Reject:         true,
+   })
+*/
+// Sizes are checked right after the 16 bytes prefix is read, before any allocation.
+// Keys and nesting depth of the json header are counted by scanning its bytes, before parsing.
+// A frame over limits returns *LimitError. By default server closes the connection,
+// when Reject is true and max byte per message is set, server discards the rest of the frame,
+// replies an error frame of PAYLOAD_TOO_LARGE or HEADER_TOO_LARGE, and keeps reading next frame.
+
+// returned when keys or nesting depth of a header is over limit
+var ErrHeaderTooComplex = errors.New("tcpx: header too complex")
+
+// FrameLimits zero values mean no limit.
+type FrameLimits struct {
+	MaxHeaderBytes int32
+	MaxBodyBytes   int32
+	// keys of all levels of a json header
+	MaxHeaderKeys int
+	// nesting depth of objects and arrays, top level object is depth 1
+	MaxHeaderDepth int
+
+	// discard a frame over limits and reply an error frame, rather than closing connection
+	Reject bool
+}
+
+func (fl FrameLimits) isZero() bool {
+	return fl.MaxHeaderBytes <= 0 && fl.MaxBodyBytes <= 0 && fl.MaxHeaderKeys <= 0 && fl.MaxHeaderDepth <= 0
+}
+
+// LimitError tells which limit a frame is over.
+type LimitError struct {
+	// ErrFrameTooLarge or ErrHeaderTooComplex
+	Kind error
+	// name of the limit, like 'MaxHeaderBytes'
+	Limit string
+	Max   int64
+	Got   int64
+
+	MessageID int32
+	// the rest of the frame has been read and dropped, connection can go on reading next frame
+	Discarded bool
+}
+
+func (le *LimitError) Error() string {
+	return fmt.Sprintf("%s, messageID %d over %s(%d), got %d", le.Kind.Error(), le.MessageID, le.Limit, le.Max, le.Got)
+}
+
+// Is reports whether target is the kind of le.
+func (le *LimitError) Is(target error) bool {
+	return target == le.Kind
+}
+
+// status code of the reject frame
+func (le *LimitError) code() int {
+	if le.Limit == "MaxBodyBytes" {
+		return PAYLOAD_TOO_LARGE
+	}
+	return HEADER_TOO_LARGE
+}
+
+// check sizes declared by prefix, which is [4]length [4]messageID [4]headerLength [4]bodyLength.
+func (fl FrameLimits) checkPrefix(prefix []byte) *LimitError {
+	messageID, _ := MessageIDOf(prefix)
+	headerLength, _ := HeaderLengthOf(prefix)
+	bodyLength, _ := BodyLengthOf(prefix)
+	if fl.MaxHeaderBytes > 0 && uint32(headerLength) > uint32(fl.MaxHeaderBytes) {
+		return &LimitError{Kind: ErrFrameTooLarge, Limit: "MaxHeaderBytes", Max: int64(fl.MaxHeaderBytes), Got: int64(uint32(headerLength)), MessageID: messageID}
+	}
+	if fl.MaxBodyBytes > 0 && uint32(bodyLength) > uint32(fl.MaxBodyBytes) {
+		return &LimitError{Kind: ErrFrameTooLarge, Limit: "MaxBodyBytes", Max: int64(fl.MaxBodyBytes), Got: int64(uint32(bodyLength)), MessageID: messageID}
+	}
+	return nil
+}
+
+// count keys and nesting depth of a json header without parsing it.
+// It stops once a limit is exceeded, so a huge header costs no more than the limit.
+func (fl FrameLimits) checkHeader(messageID int32, header []byte) *LimitError {
+	if fl.MaxHeaderKeys <= 0 && fl.MaxHeaderDepth <= 0 {
+		return nil
+	}
+	var keys, depth int
+	var inString, escaped bool
+	for _, c := range header {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if fl.MaxHeaderDepth > 0 && depth > fl.MaxHeaderDepth {
+				return &LimitError{Kind: ErrHeaderTooComplex, Limit: "MaxHeaderDepth", Max: int64(fl.MaxHeaderDepth), Got: int64(depth), MessageID: messageID}
+			}
+		case '}', ']':
+			depth--
+		case ':':
+			keys++
+			if fl.MaxHeaderKeys > 0 && keys > fl.MaxHeaderKeys {
+				return &LimitError{Kind: ErrHeaderTooComplex, Limit: "MaxHeaderKeys", Max: int64(fl.MaxHeaderKeys), Got: int64(keys), MessageID: messageID}
+			}
+		}
+	}
+	return nil
+}
+
+// drop n bytes from reader without holding them
+func discardN(reader io.Reader, n int64) error {
+	if n <= 0 {
+		return nil
+	}
+	_, e := io.CopyN(io.Discard, reader, n)
+	return e
+}
+
+// Limits of frames received, zero values mean no limit.
+// It works with SetMaxBytePerMessage, see FrameLimits.
+func (tcpx *TcpX) WithFrameLimits(limits FrameLimits) *TcpX {
+	tcpx.frameLimits = limits
+	return tcpx
+}
+
+// reply an error frame for a frame rejected by limits
+func replyLimitError(ctx *Context, le *LimitError) {
+	buf, e := PackWithMarshallerAndBody(Message{
+		MessageID: le.MessageID,
+		Header: map[string]interface{}{
+			HEADER_FRAME_TYPE:    FRAME_ERROR,
+			HEADER_ERROR_CODE:    le.code(),
+			HEADER_ERROR_MESSAGE: le.Error(),
+		},
+	}, nil)
+	if e != nil {
+		Logger.Println(e.Error())
+		return
+	}
+	if e := ctx.writeBuf(buf); e != nil {
+		Logger.Println(e.Error())
+	}
+}
@@ -0,0 +1,119 @@
+package tcpx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrameLimits(t *testing.T) {
+	pack := func(header map[string]interface{}, body string) []byte {
+		buf, e := PackWithMarshaller(Message{MessageID: 1, Header: header, Body: body}, JsonMarshaller{})
+		if e != nil {
+			t.Fatal(e.Error())
+		}
+		return buf
+	}
+	var limits = FrameLimits{MaxHeaderBytes: 64, MaxBodyBytes: 64, MaxHeaderKeys: 3, MaxHeaderDepth: 2, Reject: true}
+	var cases = []struct {
+		name  string
+		frame []byte
+		limit string
+	}{
+		{"header bytes", pack(map[string]interface{}{"k": strings.Repeat("a", 100)}, ""), "MaxHeaderBytes"},
+		{"body bytes", pack(nil, strings.Repeat("a", 100)), "MaxBodyBytes"},
+		{"header keys", pack(map[string]interface{}{"a": 1, "b": 2, "c": 3, "d": 4}, ""), "MaxHeaderKeys"},
+		{"header depth", pack(map[string]interface{}{"a": []interface{}{[]interface{}{1}}}, ""), "MaxHeaderDepth"},
+		{"colon in string", pack(map[string]interface{}{"a": ":::\\\":{[["}, "hello"), ""},
+	}
+	for _, v := range cases {
+		next := pack(nil, "next")
+		reader := bytes.NewReader(append(append([]byte{}, v.frame...), next...))
+		_, e := FirstBlockOfLimitMaxByte(reader, 1024, limits)
+		var le *LimitError
+		if v.limit == "" {
+			if e != nil {
+				fmt.Println(fmt.Sprintf("%s: want no error but got %v", v.name, e))
+				t.Fail()
+			}
+		} else if !errors.As(e, &le) || le.Limit != v.limit || !le.Discarded {
+			fmt.Println(fmt.Sprintf("%s: want discarded %s error but got %v", v.name, v.limit, e))
+			t.Fail()
+			continue
+		}
+		// frame over limits is discarded, the next one is still readable
+		block, e := FirstBlockOfLimitMaxByte(reader, 1024, limits)
+		if e != nil || !bytes.Equal(block, next) {
+			fmt.Println(fmt.Sprintf("%s: next frame should be read, got %v", v.name, e))
+			t.Fail()
+		}
+	}
+
+	_, e := FirstBlockOfLimitMaxByte(bytes.NewReader(pack(nil, strings.Repeat("a", 100))), 0, FrameLimits{MaxBodyBytes: 64, Reject: true})
+	var le *LimitError
+	if !errors.As(e, &le) || le.Discarded || !errors.Is(e, ErrFrameTooLarge) {
+		fmt.Println(fmt.Sprintf("without max byte, frame should not be discarded, got %v", e))
+		t.Fail()
+	}
+}
+
+func TestFrameLimits_DeclaredLength(t *testing.T) {
+	// small header and body, but a length of nearly 4GiB
+	var prefix = make([]byte, 16)
+	binary.BigEndian.PutUint32(prefix[0:4], 0xFFFFFFF0)
+	binary.BigEndian.PutUint32(prefix[4:8], 1)
+	limits := FrameLimits{MaxHeaderBytes: 1024, MaxBodyBytes: 1024}
+	if _, e := FirstBlockOfLimitMaxByte(bytes.NewReader(prefix), 0, limits); !errors.Is(e, ErrFrameTooLarge) {
+		fmt.Println(fmt.Sprintf("frame declaring a length beyond its header and body want ErrFrameTooLarge but got %v", e))
+		t.Fail()
+	}
+}
+
+func TestTcpX_RejectFrame(t *testing.T) {
+	srv := NewTcpX(JsonMarshaller{})
+	srv.SetMaxBytePerMessage(1024)
+	srv.WithFrameLimits(FrameLimits{MaxHeaderKeys: 8, Reject: true})
+	srv.AddHandler(1, func(c *Context) {
+		c.Reply(1, "ok")
+	})
+	go srv.ListenAndServe("tcp", ":7017")
+	time.Sleep(500 * time.Millisecond)
+
+	conn, e := net.Dial("tcp", "localhost:7017")
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer conn.Close()
+
+	var header = make(map[string]interface{})
+	for i := 0; i < 10; i++ {
+		header[fmt.Sprintf("key-%d", i)] = i
+	}
+	bad, _ := PackWithMarshaller(Message{MessageID: 1, Header: header}, JsonMarshaller{})
+	good, _ := PackWithMarshaller(Message{MessageID: 1, Body: "hi"}, JsonMarshaller{})
+	conn.Write(append(bad, good...))
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	block, e := FirstBlockOf(conn)
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	if se := StatusErrorOf(block); se == nil || se.Code != HEADER_TOO_LARGE {
+		fmt.Println(fmt.Sprintf("want reject frame of %d but got %v", HEADER_TOO_LARGE, se))
+		t.Fail()
+	}
+	block, e = FirstBlockOf(conn)
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	var reply string
+	if _, e := PackJSON.Unpack(block, &reply); e != nil || reply != "ok" {
+		fmt.Println(fmt.Sprintf("connection should go on after reject, got '%s', %v", reply, e))
+		t.Fail()
+	}
+}
@@ -3,11 +3,15 @@ package tcpx
 import (
 	"encoding/json"
 	"encoding/xml"
-	"errors"
-	"fmt"
 	"github.com/fwhezfwhez/errorx"
+	"github.com/fxamacker/cbor/v2"
 	"github.com/golang/protobuf/proto"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.mongodb.org/mongo-driver/bson"
 	"gopkg.in/yaml.v2"
+	"sort"
+	"strings"
+	"sync"
 )
 
 type Marshaller interface {
@@ -16,21 +20,83 @@ type Marshaller interface {
 	MarshalName() string
 }
 
+// marshallers by name, senders stamp MarshalName() in header 'Pack-Content-Type', receivers find the decoder here.
+var marshallers = struct {
+	l *sync.RWMutex
+	m map[string]Marshaller
+}{
+	l: &sync.RWMutex{},
+	m: make(map[string]Marshaller),
+}
+
+func init() {
+	RegisterMarshaller("json", JsonMarshaller{})
+	RegisterMarshaller("xml", XmlMarshaller{})
+	RegisterMarshaller("toml", TomlMarshaller{})
+	RegisterMarshaller("tml", TomlMarshaller{})
+	RegisterMarshaller("yaml", YamlMarshaller{})
+	RegisterMarshaller("yml", YamlMarshaller{})
+	RegisterMarshaller("protobuf", ProtobufMarshaller{})
+	RegisterMarshaller("proto", ProtobufMarshaller{})
+	RegisterMarshaller("msgpack", MsgpackMarshaller{})
+	RegisterMarshaller("cbor", CborMarshaller{})
+	RegisterMarshaller("bson", BsonMarshaller{})
+}
+
+// Register a marshaller by name, a registered name will be replaced.
+// Register m.MarshalName() at least, since it's what senders stamp in header 'Pack-Content-Type'.
+// Other names work as aliases.
+// ```
+//     tcpx.RegisterMarshaller("gob", GobMarshaller{})
+// ```
+func RegisterMarshaller(name string, m Marshaller) {
+	if name == "" || m == nil {
+		panic("tcpx: RegisterMarshaller requires a name and a marshaller")
+	}
+	marshallers.l.Lock()
+	defer marshallers.l.Unlock()
+	marshallers.m[name] = m
+}
+
+// Names of registered marshallers, sorted.
+func MarshallerNames() []string {
+	marshallers.l.RLock()
+	defer marshallers.l.RUnlock()
+	var names = make([]string, 0, len(marshallers.m))
+	for k := range marshallers.m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func GetMarshallerByMarshalName(marshalName string) (Marshaller, error) {
-	switch marshalName {
-	case "json":
-		return JsonMarshaller{}, nil
-	case "xml":
-		return XmlMarshaller{}, nil
-	case "toml", "tml":
-		return TomlMarshaller{}, nil
-	case "yaml", "yml":
-		return YamlMarshaller{}, nil
-	case "protobuf", "proto":
-		return ProtobufMarshaller{}, nil
-	default:
-		return nil, errors.New(fmt.Sprintf("unknown marshalName %s,requires in [json,xml,toml,yaml,protobuf]", marshalName))
+	marshallers.l.RLock()
+	m, ok := marshallers.m[marshalName]
+	marshallers.l.RUnlock()
+	if !ok {
+		return nil, newFrameError(ErrUnknownMarshaller, nil, "unknown marshalName '%s', requires in [%s]", marshalName, strings.Join(MarshallerNames(), ","))
+	}
+	return m, nil
+}
+
+// Marshaller of the body of stream, decided by header 'Pack-Content-Type'.
+// When the header is not set, names defaultMarshaller or names an unregistered marshaller, it returns defaultMarshaller,
+// so that peers sharing a custom marshaller work without registering it.
+func MarshallerOf(stream []byte, defaultMarshaller Marshaller) (Marshaller, error) {
+	header, e := HeaderOf(stream)
+	if e != nil {
+		return nil, e
+	}
+	name, _, _ := headerGetString(header, HEADER_PACK_TYPE)
+	if name == "" || (defaultMarshaller != nil && name == defaultMarshaller.MarshalName()) {
+		return defaultMarshaller, nil
 	}
+	m, e := GetMarshallerByMarshalName(name)
+	if e != nil {
+		return defaultMarshaller, nil
+	}
+	return m, nil
 }
 
 type JsonMarshaller struct{}
@@ -108,3 +174,43 @@ func (pm ProtobufMarshaller) Unmarshal(data []byte, dest interface{}) error {
 func (pm ProtobufMarshaller) MarshalName() string {
 	return "protobuf"
 }
+
+type MsgpackMarshaller struct{}
+
+func (mm MsgpackMarshaller) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+func (mm MsgpackMarshaller) Unmarshal(data []byte, dest interface{}) error {
+	return msgpack.Unmarshal(data, dest)
+}
+
+func (mm MsgpackMarshaller) MarshalName() string {
+	return "msgpack"
+}
+
+type CborMarshaller struct{}
+
+func (cm CborMarshaller) Marshal(v interface{}) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+func (cm CborMarshaller) Unmarshal(data []byte, dest interface{}) error {
+	return cbor.Unmarshal(data, dest)
+}
+
+func (cm CborMarshaller) MarshalName() string {
+	return "cbor"
+}
+
+type BsonMarshaller struct{}
+
+// v should be a document, like a struct or a map, bson can't marshal a plain value like "hello" alone
+func (bm BsonMarshaller) Marshal(v interface{}) ([]byte, error) {
+	return bson.Marshal(v)
+}
+func (bm BsonMarshaller) Unmarshal(data []byte, dest interface{}) error {
+	return bson.Unmarshal(data, dest)
+}
+
+func (bm BsonMarshaller) MarshalName() string {
+	return "bson"
+}
@@ -1,10 +1,13 @@
 package tcpx
 
 import (
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"github.com/fwhezfwhez/errorx"
 	"testing"
+	"time"
 )
 
 func TestJsonMarshaller(t *testing.T) {
@@ -121,3 +124,149 @@ func TestGetMarshallerByMarshalName(t *testing.T) {
 	)
 
 }
+
+type gobLikeMarshaller struct {
+	JsonMarshaller
+}
+
+func (gobLikeMarshaller) MarshalName() string {
+	return "gob-like"
+}
+
+func TestRegisterMarshaller(t *testing.T) {
+	if _, e := GetMarshallerByMarshalName("gob-like"); !errors.Is(e, ErrUnknownMarshaller) {
+		fmt.Println(fmt.Sprintf("want ErrUnknownMarshaller but got %v", e))
+		t.Fail()
+	}
+	RegisterMarshaller("gob-like", gobLikeMarshaller{})
+	m, e := GetMarshallerByMarshalName("gob-like")
+	if e != nil || m.MarshalName() != "gob-like" {
+		fmt.Println(fmt.Sprintf("want gob-like marshaller but got %v, %v", m, e))
+		t.Fail()
+	}
+
+	buf, e := NewPackx(gobLikeMarshaller{}).Pack(1, "hello")
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	m, e = MarshallerOf(buf, JsonMarshaller{})
+	if e != nil || m.MarshalName() != "gob-like" {
+		fmt.Println(fmt.Sprintf("pack should stamp 'gob-like' but got %v, %v", m, e))
+		t.Fail()
+	}
+}
+
+// never registered, peers sharing it should still work
+type unregisteredMarshaller struct {
+	JsonMarshaller
+}
+
+func (unregisteredMarshaller) MarshalName() string {
+	return "mine"
+}
+
+func TestUnregisteredMarshaller(t *testing.T) {
+	buf, e := NewPackx(unregisteredMarshaller{}).Pack(1, "hello")
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	if m, e := MarshallerOf(buf, unregisteredMarshaller{}); e != nil || m.MarshalName() != "mine" {
+		fmt.Println(fmt.Sprintf("want default marshaller 'mine' but got %v, %v", m, e))
+		t.Fail()
+	}
+	if m, e := MarshallerOf(buf, JsonMarshaller{}); e != nil || m.MarshalName() != "json" {
+		fmt.Println(fmt.Sprintf("unregistered name should fall back to default marshaller but got %v, %v", m, e))
+		t.Fail()
+	}
+
+	srv := NewTcpX(unregisteredMarshaller{})
+	srv.AddHandler(1, func(c *Context) {
+		var name string
+		if _, e := c.Bind(&name); e != nil {
+			c.Reply(1, "bind: "+e.Error())
+			return
+		}
+		c.Reply(1, "hello, "+name)
+	})
+	go srv.ListenAndServe("tcp", ":7031")
+	time.Sleep(500 * time.Millisecond)
+
+	client, e := Dial("tcp", "localhost:7031", unregisteredMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+	var reply string
+	if e := client.Call(context.Background(), 1, "tcpx", &reply); e != nil || reply != "hello, tcpx" {
+		fmt.Println(fmt.Sprintf("want 'hello, tcpx' but got '%s', %v", reply, e))
+		t.Fail()
+	}
+}
+
+func TestContext_MarshallerNegotiation(t *testing.T) {
+	type User struct {
+		XMLName  xml.Name `xml:"user" json:"-" yaml:"-"`
+		Username string   `xml:"username" json:"username" yaml:"username"`
+	}
+	srv := NewTcpX(JsonMarshaller{})
+	srv.AddHandler(1, func(c *Context) {
+		var user User
+		if _, e := c.Bind(&user); e != nil {
+			return
+		}
+		user.Username = "hello, " + user.Username
+		c.Reply(1, user)
+	})
+	go srv.ListenAndServe("tcp", ":7018")
+	time.Sleep(500 * time.Millisecond)
+
+	for _, marshaller := range []Marshaller{JsonMarshaller{}, XmlMarshaller{}, YamlMarshaller{}} {
+		client, e := Dial("tcp", "localhost:7018", marshaller)
+		if e != nil {
+			t.Fatal(e.Error())
+		}
+		client.Timeout = 3 * time.Second
+		var user User
+		if e := client.Call(context.Background(), 1, User{Username: "tcpx"}, &user); e != nil || user.Username != "hello, tcpx" {
+			fmt.Println(fmt.Sprintf("%s client want 'hello, tcpx' but got '%s', %v", marshaller.MarshalName(), user.Username, e))
+			t.Fail()
+		}
+		client.Close()
+	}
+}
+
+func TestMsgpackCborBsonMarshaller(t *testing.T) {
+	type User struct {
+		Username string `msgpack:"username" cbor:"username" bson:"username"`
+		Age      int    `msgpack:"age" cbor:"age" bson:"age"`
+	}
+	var binds = map[string]func(pt *PackType, dest interface{}) error{
+		"msgpack": (*PackType).BindMsgpack,
+		"cbor":    (*PackType).BindCBOR,
+		"bson":    (*PackType).BindBSON,
+	}
+	for _, packx := range []*Packx{PackMsgpack, PackCbor, PackBson} {
+		name := packx.Marshaller.MarshalName()
+		buf, e := packx.Pack(1, User{Username: "tcpx", Age: 3})
+		if e != nil {
+			fmt.Println(fmt.Sprintf("%s: %s", name, e.Error()))
+			t.Fail()
+			continue
+		}
+		var user User
+		if _, e := packx.Unpack(buf, &user); e != nil || user.Username != "tcpx" || user.Age != 3 {
+			fmt.Println(fmt.Sprintf("%s: unpack want {tcpx 3} but got %v, %v", name, user, e))
+			t.Fail()
+		}
+		var bound User
+		pt := PackType(buf)
+		if e := binds[name](&pt, &bound); e != nil || bound != user {
+			fmt.Println(fmt.Sprintf("%s: bind want %v but got %v, %v", name, user, bound, e))
+			t.Fail()
+		}
+		if m, e := MarshallerOf(buf, nil); e != nil || m.MarshalName() != name {
+			fmt.Println(fmt.Sprintf("%s: should be registered, got %v", name, e))
+			t.Fail()
+		}
+	}
+}
@@ -1,8 +1,35 @@
 package tcpx
 
+import "errors"
+
 const (
 	SERVER_ERROR = 500
 	CLIENT_ERROR = 400
 	OK           = 200
 	NOT_AUTH     = 403
+	NOT_FOUND    = 404
+
+	PAYLOAD_TOO_LARGE = 413
+	HEADER_TOO_LARGE  = 431
+)
+
+// messageIDs in [RESERVED_MESSAGEID_MIN, RESERVED_MESSAGEID_MAX] are reserved for framework messages:
+// heartbeat(DEFAULT_HEARTBEAT_MESSAGEID), auth(DEFAULT_AUTH_MESSAGEID), handshake(DEFAULT_HANDSHAKE_MESSAGEID), batch(DEFAULT_BATCH_MESSAGEID),
+// the rest are kept for later ones, like errors and ping.
+// srv.AddHandler rejects them, handlers of framework messages are set by srv.HeartBeatMode, srv.WithAuthDetail...
+const (
+	RESERVED_MESSAGEID_MIN = 1392
+	RESERVED_MESSAGEID_MAX = 1399
 )
+
+// returned when registering a reserved messageID
+var ErrReservedMessageID = errors.New("tcpx: reserved messageID")
+
+// Whether messageID is reserved for framework messages.
+func IsReservedMessageID(messageID int32) bool {
+	return messageID >= RESERVED_MESSAGEID_MIN && messageID <= RESERVED_MESSAGEID_MAX
+}
+
+func reservedMessageIDError(messageID int32) error {
+	return newFrameError(ErrReservedMessageID, nil, "messageID %d is in [%d, %d], reserved for framework messages", messageID, RESERVED_MESSAGEID_MIN, RESERVED_MESSAGEID_MAX)
+}
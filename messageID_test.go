@@ -0,0 +1,81 @@
+package tcpx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recover the panic value of f as an error
+func panicOf(f func()) (e error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, _ = r.(error)
+			if e == nil {
+				e = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+	f()
+	return nil
+}
+
+func TestTcpX_RouteConflict(t *testing.T) {
+	srv := NewTcpX(JsonMarshaller{})
+	srv.AddHandler(1, func(c *Context) {})
+	e := panicOf(func() {
+		srv.MessageIDGroup(1, 10).AddHandler(1, func(c *Context) {})
+	})
+	if !errors.Is(e, ErrRouteConflict) {
+		t.Fatal(fmt.Sprintf("want ErrRouteConflict but got %v", e))
+	}
+	// both registrations are located
+	if strings.Count(e.Error(), "messageID_test.go:") != 2 {
+		fmt.Println(fmt.Sprintf("conflict should tell locations of both registrations, got:\n%s", e.Error()))
+		t.Fail()
+	}
+
+	srv.Any("/hello/", func(c *Context) {})
+	e = panicOf(func() {
+		srv.Group("/hel").Any("lo/", func(c *Context) {})
+	})
+	if !errors.Is(e, ErrRouteConflict) || strings.Count(e.Error(), "messageID_test.go:") != 2 {
+		fmt.Println(fmt.Sprintf("url-pattern conflict want ErrRouteConflict with 2 locations but got %v", e))
+		t.Fail()
+	}
+
+	// heartbeat of a business messageID conflicts with business handlers
+	srv.HeartBeatModeDetail(true, 10*time.Second, false, 2)
+	if e := panicOf(func() { srv.AddHandler(2, func(c *Context) {}) }); !errors.Is(e, ErrRouteConflict) {
+		fmt.Println(fmt.Sprintf("heartbeat conflict want ErrRouteConflict but got %v", e))
+		t.Fail()
+	}
+}
+
+func TestTcpX_ReservedMessageID(t *testing.T) {
+	srv := NewTcpX(JsonMarshaller{})
+	for _, messageID := range []int32{DEFAULT_HEARTBEAT_MESSAGEID, DEFAULT_AUTH_MESSAGEID, DEFAULT_HANDSHAKE_MESSAGEID, DEFAULT_BATCH_MESSAGEID, RESERVED_MESSAGEID_MAX} {
+		if e := panicOf(func() { srv.AddHandler(messageID, func(c *Context) {}) }); !errors.Is(e, ErrReservedMessageID) {
+			fmt.Println(fmt.Sprintf("messageID %d want ErrReservedMessageID but got %v", messageID, e))
+			t.Fail()
+		}
+	}
+	if e := panicOf(func() { srv.AddHandler(RESERVED_MESSAGEID_MAX+1, func(c *Context) {}) }); e != nil {
+		fmt.Println(fmt.Sprintf("messageID %d is not reserved but got %v", RESERVED_MESSAGEID_MAX+1, e))
+		t.Fail()
+	}
+
+	// framework messages still register reserved messageIDs
+	srv.HeartBeatMode(true, 10*time.Second)
+	srv.WithAuthDetail(true, 10*time.Second, false, DEFAULT_AUTH_MESSAGEID, func(c *Context) {})
+	if e := srv.ReplaceHandler(DEFAULT_HEARTBEAT_MESSAGEID, func(c *Context) {}); !errors.Is(e, ErrReservedMessageID) {
+		fmt.Println(fmt.Sprintf("replacing heartbeat want ErrReservedMessageID but got %v", e))
+		t.Fail()
+	}
+	if len(srv.Routes()) != 3 {
+		fmt.Println(fmt.Sprintf("want 3 routes but got %d", len(srv.Routes())))
+		t.Fail()
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/fwhezfwhez/errorx"
+	"strings"
 	"sync"
 	"sync/atomic"
 )
@@ -14,6 +15,9 @@ const (
 	NOT_EXPIRE = 2019
 )
 
+// panicked with when a messageID or url-pattern is registered twice
+var ErrRouteConflict = errors.New("tcpx: route conflict")
+
 // Mux is used to register different request by messageID
 // Middlewares are divided into 3 kinds:
 // 1. global  --> GlobalTypeMiddlewares
@@ -43,14 +47,32 @@ type Mux struct {
 	MiddlewareAnchorMap map[string]MiddlewareAnchor
 	// messageID handlers anchors
 	MessageIDAnchorMap map[int32]MessageIDAnchor
+	// where messageID routes are registered
+	messageIDRouteInfo map[int32]Route
+	// conditional routes of messageID in order of registration, see srv.When
+	messageIDCandidates map[int32][]routeCandidate
 
 	// urlMux
 	urlMux *URLMux
+
+	// fallbacks of frames routed to no handler, see NoRoute and NoMessageID
+	noRoute     []func(ctx *Context)
+	noMessageID []func(ctx *Context)
+
+	// middlewares added by UseWhen, in order of adding
+	whenMiddlewares []whenMiddleware
+	// cached results of predicates of whenMiddlewares
+	whenResults map[whenResultKey]bool
+
+	// anchor and conditional middlewares disabled by key, see DisableMiddleware
+	disabledMiddlewares map[string]bool
+	// *routeTable read by handler goroutines, nil after a change until it's rebuilt
+	table atomic.Value
 }
 
 // New a mux instance, malloc memory for its mutex, handler slice...
 func NewMux() *Mux {
-	return &Mux{
+	mux := &Mux{
 		indexSeed: 1,
 		Mutex:     &sync.RWMutex{},
 		Handlers:  make(map[int32]func(ctx *Context)),
@@ -62,18 +84,24 @@ func NewMux() *Mux {
 		MiddlewareAnchors:   make([]MiddlewareAnchor, 0, 10),
 		MiddlewareAnchorMap: make(map[string]MiddlewareAnchor, 0),
 		MessageIDAnchorMap:  make(map[int32]MessageIDAnchor, 0),
+		messageIDRouteInfo:  make(map[int32]Route, 0),
 
 
 		urlMux: NewURLMux(),
 	}
+	mux.publish()
+	return mux
 }
 
 // Any is used to routing message using url-pattern
 func (mux *Mux) Any(urlPattern string, handlers ... func(c *Context)) error {
 	if mux.isReadOnly() == false {
+		mux.Mutex.Lock()
+		defer mux.Mutex.Unlock()
 		if e := mux.urlMux.AddURLPatternHandler(urlPattern, handlers...); e != nil {
 			return errorx.Wrap(e)
 		}
+		mux.publish()
 		return nil
 	} else {
 		return errorx.NewFromString("mux is only writable before mux.LockWrite()")
@@ -85,13 +113,108 @@ func (mux *Mux) AddHandleFunc(messageID int32, handler func(ctx *Context)) {
 	if mux.AllowAdd == false {
 		panic(errors.New("mux.AllowAdd is false, you should use AddHandleFunc before it's locked, after calling  tcpx.ListenAndServe(), the mux will be locked"))
 	}
+	if IsReservedMessageID(messageID) {
+		panic(reservedMessageIDError(messageID))
+	}
 	mux.Mutex.Lock()
 	defer mux.Mutex.Unlock()
 	_, ok := mux.Handlers[messageID]
 	if ok {
-		panic(errors.New(fmt.Sprintf("messageID '%d' already has its handler", messageID)))
+		panic(routeConflict(fmt.Sprintf("messageID %d", messageID), mux.messageIDRouteInfo[messageID]))
 	}
 	mux.Handlers[messageID] = handler
+	if mux.messageIDRouteInfo == nil {
+		mux.messageIDRouteInfo = make(map[int32]Route, 0)
+	}
+	mux.messageIDRouteInfo[messageID] = Route{
+		MessageId: int(messageID),
+		Whereis:   []string{callerLocation()},
+	}
+	mux.publish()
+}
+
+// add a conditional route of messageID, see srv.When.
+func (mux *Mux) addMessageIDCandidate(messageID int32, anchorIndex int, matchers []Matcher, handlers []func(ctx *Context)) {
+	if mux.AllowAdd == false {
+		panic(errors.New("mux.AllowAdd is false, you should use AddHandleFunc before it's locked, after calling  tcpx.ListenAndServe(), the mux will be locked"))
+	}
+	mux.Mutex.Lock()
+	defer mux.Mutex.Unlock()
+	candidate := newRouteCandidate(anchorIndex, matchers, handlers)
+	for _, v := range mux.messageIDCandidates[messageID] {
+		if v.sameConditions(candidate) {
+			panic(routeConflict(fmt.Sprintf("messageID %d when %s", messageID, strings.Join(candidate.conditions(), ", ")), Route{MessageId: int(messageID), Whereis: []string{v.whereis}}))
+		}
+	}
+	if mux.messageIDCandidates == nil {
+		mux.messageIDCandidates = make(map[int32][]routeCandidate, 0)
+	}
+	mux.messageIDCandidates[messageID] = append(mux.messageIDCandidates[messageID], candidate)
+	mux.publish()
+}
+
+// add handler, self-related middlewares and anchor of messageID at once, so that handler goroutines never see half of them.
+// The last of handlers is the handler.
+func (mux *Mux) addMessageIDRoute(messageID int32, anchorIndex int, handlers []func(ctx *Context)) {
+	if mux.AllowAdd == false {
+		panic(errors.New("mux.AllowAdd is false, you should use AddHandleFunc before it's locked, after calling  tcpx.ListenAndServe(), the mux will be locked"))
+	}
+	mux.Mutex.Lock()
+	defer mux.Mutex.Unlock()
+	if _, ok := mux.Handlers[messageID]; ok {
+		panic(routeConflict(fmt.Sprintf("messageID %d", messageID), mux.messageIDRouteInfo[messageID]))
+	}
+	if _, ok := mux.MessageIDSelfMiddleware[messageID]; ok {
+		panic(errorx.NewFromStringf("messageIDSelfMiddleware[%d] already exist", messageID))
+	}
+	if _, ok := mux.MessageIDAnchorMap[messageID]; ok {
+		panic(errorx.NewFromStringf("mux.MessageIDAnchorMap[%d] already exists", messageID))
+	}
+	if len(handlers) > 1 {
+		mux.MessageIDSelfMiddleware[messageID] = copyHandlers(handlers[:len(handlers)-1])
+	}
+	mux.Handlers[messageID] = handlers[len(handlers)-1]
+	mux.MessageIDAnchorMap[messageID] = NewMessageIDAnchor(messageID, anchorIndex)
+	if mux.messageIDRouteInfo == nil {
+		mux.messageIDRouteInfo = make(map[int32]Route, 0)
+	}
+	mux.messageIDRouteInfo[messageID] = Route{
+		MessageId: int(messageID),
+		Whereis:   []string{callerLocation()},
+	}
+	mux.publish()
+}
+
+// panic value of registering a route twice, with locations of both registrations
+func routeConflict(route string, existed Route) error {
+	return newFrameError(ErrRouteConflict, nil, "handler conflicts on the same %s: \n%s\nThe existed route-info is at:\n%s", route, callerLocation(), existed.Location())
+}
+
+// add handlers and anchor of urlPattern at once, the same as addMessageIDRoute.
+func (mux *Mux) addURLRoute(urlPattern string, anchorIndex int, handlers []func(ctx *Context)) error {
+	if mux.isReadOnly() {
+		return errorx.NewFromString("mux is only writable before mux.LockWrite()")
+	}
+	if matchers, _ := splitMatchers(handlers); len(matchers) > 0 {
+		return errorx.NewFromStringf("url-pattern %s: matchers are only supported by messageID routes", urlPattern)
+	}
+	mux.Mutex.Lock()
+	defer mux.Mutex.Unlock()
+	if mux.urlMux.URLAnchorMap == nil {
+		mux.urlMux.URLAnchorMap = make(map[string]MessageIDAnchor, 0)
+	}
+	if _, ok := mux.urlMux.urlPatternMux[urlPattern]; ok {
+		panic(routeConflict(fmt.Sprintf("url-pattern %s", urlPattern), mux.urlMux.urlRouteInfo[urlPattern]))
+	}
+	if _, ok := mux.urlMux.URLAnchorMap[urlPattern]; ok {
+		panic(errorx.NewFromStringf("mux.urlMux.URLAnchorMap[%s] already exists", urlPattern))
+	}
+	if e := mux.urlMux.AddURLPatternHandler(urlPattern, handlers...); e != nil {
+		return errorx.Wrap(e)
+	}
+	mux.urlMux.URLAnchorMap[urlPattern] = NewUrlPatternAnchor(urlPattern, anchorIndex)
+	mux.publish()
+	return nil
 }
 
 // anchorIndex of current handlers
@@ -153,6 +276,15 @@ func (mux *Mux) AddMiddlewareAnchor(anchor MiddlewareAnchor) {
 	}
 	mux.MiddlewareAnchorMap[anchor.MiddlewareKey] = anchor
 	mux.MiddlewareAnchors = append(mux.MiddlewareAnchors, anchor)
+	mux.publish()
+}
+
+// get a middleware anchor by key
+func (mux *Mux) middlewareAnchor(middlewareKey string) (MiddlewareAnchor, bool) {
+	mux.Mutex.RLock()
+	defer mux.Mutex.RUnlock()
+	anchor, ok := mux.MiddlewareAnchorMap[middlewareKey]
+	return anchor, ok
 }
 
 // Used to reset anchor's ExpiredAnchorIndex, avoiding operate map straightly.
@@ -180,6 +312,7 @@ L:
 			break L
 		}
 	}
+	mux.publish()
 }
 
 // add messageID anchor
@@ -195,6 +328,7 @@ func (mux *Mux) AddMessageIDAnchor(anchor MessageIDAnchor) {
 		panic(errorx.NewFromStringf("mux.MessageIDAnchorMap[%d] already exists", anchor.MessageID))
 	}
 	mux.MessageIDAnchorMap[anchor.MessageID] = anchor
+	mux.publish()
 }
 
 // add url-pattern anchor
@@ -210,6 +344,7 @@ func (mux *Mux) AddURLAnchor(anchor MessageIDAnchor) {
 		panic(errorx.NewFromStringf("mux.urlMux.URLAnchorMap[%s] already exists", anchor.URLPattern))
 	}
 	mux.urlMux.URLAnchorMap[anchor.URLPattern] = anchor
+	mux.publish()
 }
 
 // add middleware by srv.Add(1, middleware1, middleware2, handler)
@@ -225,6 +360,7 @@ func (mux *Mux) AddMessageIDSelfMiddleware(messageID int32, handlers ... func(c
 		mux.MessageIDSelfMiddleware[messageID] = make([]func(ctx *Context), 0, 10)
 		mux.MessageIDSelfMiddleware[messageID] = append(mux.MessageIDSelfMiddleware[messageID], handlers...)
 	}
+	mux.publish()
 
 }
 
@@ -233,6 +369,7 @@ func (mux *Mux) AddGlobalMiddleware(handlers ... func(c *Context)) {
 	mux.Mutex.Lock()
 	defer mux.Mutex.Unlock()
 	mux.GlobalMiddlewares = append(mux.GlobalMiddlewares, handlers ...)
+	mux.publish()
 }
 
 func (mux *Mux) isReadOnly() bool {
@@ -0,0 +1,65 @@
+package tcpx
+
+// ## introduction:
+// Frames routed to no handler go to fallback handlers, after global middlewares:
+/*
+   srv.NoMessageID(func(c *tcpx.Context) {
+       messageID, _ := c.Packx.MessageIDOf(c.Stream)
+       proxy.Forward(messageID, c.Stream)
+   })
+   srv.NoRoute(logUnknown, tcpx.NotFound)
+*/
+// By default, both are NotFound, which logs the frame and replies an error frame of NOT_FOUND when the caller is waiting.
+// Anchor middlewares by Use/UnUse and self-related middlewares don't run for fallbacks, since the frame has no route.
+// Items of a batch are not routed to fallbacks, they are reported as BATCH_STATUS_NOT_FOUND.
+
+// Set handlers of frames whose url-pattern matches no route.
+func (tcpx *TcpX) NoRoute(handlers ...func(c *Context)) {
+	if tcpx.Mux == nil {
+		tcpx.Mux = NewMux()
+	}
+	tcpx.Mux.Mutex.Lock()
+	defer tcpx.Mux.Mutex.Unlock()
+	tcpx.Mux.noRoute = copyHandlers(handlers)
+	tcpx.Mux.publish()
+}
+
+// Set handlers of frames whose messageID has no handler.
+func (tcpx *TcpX) NoMessageID(handlers ...func(c *Context)) {
+	if tcpx.Mux == nil {
+		tcpx.Mux = NewMux()
+	}
+	tcpx.Mux.Mutex.Lock()
+	defer tcpx.Mux.Mutex.Unlock()
+	tcpx.Mux.noMessageID = copyHandlers(handlers)
+	tcpx.Mux.publish()
+}
+
+// NotFound is the default handler of NoRoute and NoMessageID.
+// It logs the frame and replies an error frame of NOT_FOUND when the request carries 'Request-ID'.
+func NotFound(c *Context) {
+	var e *FrameError
+	if c.RouterType() == URLPATTERN {
+		url, _ := URLPatternOf(c.Stream)
+		e = newFrameError(ErrUnknownRoute, nil, "urlPattern %s handler not found", url)
+	} else {
+		messageID, _ := MessageIDOf(c.Stream)
+		e = newFrameError(ErrUnknownRoute, nil, "messageID %d handler not found", messageID)
+	}
+	Logger.Println(e.Error())
+	c.autoReplyError(NOT_FOUND, e)
+}
+
+// run fallbacks after global middlewares, NotFound when fallbacks are not set
+func handleNoRoute(ctx *Context, rt *routeTable, fallbacks []func(c *Context)) {
+	if len(fallbacks) == 0 {
+		fallbacks = []func(c *Context){NotFound}
+	}
+	if ctx.handlers == nil {
+		ctx.handlers = make([]func(c *Context), 0, 10)
+	}
+	ctx.handlers = append(ctx.handlers, rt.globals...)
+	ctx.handlers = append(ctx.handlers, fallbacks...)
+	ctx.Next()
+	ctx.Reset()
+}
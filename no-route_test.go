@@ -0,0 +1,53 @@
+package tcpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTcpX_NoRoute(t *testing.T) {
+	var globals int32
+	srv := NewTcpX(JsonMarshaller{})
+	srv.UseGlobal(func(c *Context) {
+		atomic.AddInt32(&globals, 1)
+	})
+	srv.NoMessageID(func(c *Context) {
+		messageID, _ := c.Packx.MessageIDOf(c.Stream)
+		c.Reply(messageID, fmt.Sprintf("fallback %d", messageID))
+	})
+	srv.NoRoute(func(c *Context) {
+		c.SetCtxPerRequest("logged", true)
+	}, func(c *Context) {
+		if logged, _ := c.GetCtxPerRequest("logged"); logged != true {
+			return
+		}
+		NotFound(c)
+	})
+	go srv.ListenAndServe("tcp", ":7024")
+	time.Sleep(500 * time.Millisecond)
+
+	client, e := Dial("tcp", "localhost:7024", JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+	client.Timeout = 3 * time.Second
+
+	var got string
+	if e := client.Call(context.Background(), 9, nil, &got); e != nil || got != "fallback 9" {
+		fmt.Println(fmt.Sprintf("NoMessageID want 'fallback 9' but got '%s', %v", got, e))
+		t.Fail()
+	}
+	if e := client.CallURLPattern(context.Background(), "/none/", nil, nil); !errors.Is(e, ErrUnknownRoute) {
+		fmt.Println(fmt.Sprintf("NoRoute want not-found error but got %v", e))
+		t.Fail()
+	}
+	if n := atomic.LoadInt32(&globals); n != 2 {
+		fmt.Println(fmt.Sprintf("global middleware should run for fallbacks 2 times but ran %d", n))
+		t.Fail()
+	}
+}
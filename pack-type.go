@@ -3,22 +3,25 @@ package tcpx
 import (
 	"encoding/json"
 	"encoding/xml"
-	"github.com/fwhezfwhez/errorx"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.mongodb.org/mongo-driver/bson"
 	"google.golang.org/protobuf/proto"
 	"gopkg.in/yaml.v2"
 )
 
 // PackType requires buffer message marshalled by tcpx.Pack
+// Errors of binding are *FrameError, check them by errors.Is(e, tcpx.ErrBodyDecode).
 type PackType []byte
 
 func (pt *PackType) BindJSON(dest interface{}) error {
 	body, e := BodyBytesOf(*pt)
 	if e != nil {
-		return errorx.Wrap(e)
+		return e
 	}
 
 	if e := json.Unmarshal(body, dest); e != nil {
-		return errorx.Wrap(e)
+		return newFrameError(ErrBodyDecode, e, "marshaller 'json'")
 	}
 	return nil
 }
@@ -26,53 +29,86 @@ func (pt *PackType) BindJSON(dest interface{}) error {
 func (pt *PackType) BindProtobuf(dest proto.Message) error {
 	body, e := BodyBytesOf(*pt)
 	if e != nil {
-		return errorx.Wrap(e)
+		return e
 	}
 
 	if e := proto.Unmarshal(body, dest); e != nil {
-		return errorx.Wrap(e)
+		return newFrameError(ErrBodyDecode, e, "marshaller 'protobuf'")
 	}
 	return nil
 }
 func (pt *PackType) BindTOML(dest interface{}) error {
 	body, e := BodyBytesOf(*pt)
 	if e != nil {
-		return errorx.Wrap(e)
+		return e
 	}
 
 	if e := UnmarshalTOML(body, dest); e != nil {
-		return errorx.Wrap(e)
+		return newFrameError(ErrBodyDecode, e, "marshaller 'toml'")
 	}
 	return nil
 }
 func (pt *PackType) BindYAML(dest interface{}) error {
 	body, e := BodyBytesOf(*pt)
 	if e != nil {
-		return errorx.Wrap(e)
+		return e
 	}
 
 	if e := yaml.Unmarshal(body, dest); e != nil {
-		return errorx.Wrap(e)
+		return newFrameError(ErrBodyDecode, e, "marshaller 'yaml'")
 	}
 	return nil
 }
 func (pt *PackType) BindXML(dest interface{}) error {
 	body, e := BodyBytesOf(*pt)
 	if e != nil {
-		return errorx.Wrap(e)
+		return e
 	}
 
 	if e := xml.Unmarshal(body, dest); e != nil {
-		return errorx.Wrap(e)
+		return newFrameError(ErrBodyDecode, e, "marshaller 'xml'")
+	}
+	return nil
+}
+
+func (pt *PackType) BindMsgpack(dest interface{}) error {
+	body, e := BodyBytesOf(*pt)
+	if e != nil {
+		return e
+	}
+
+	if e := msgpack.Unmarshal(body, dest); e != nil {
+		return newFrameError(ErrBodyDecode, e, "marshaller 'msgpack'")
+	}
+	return nil
+}
+func (pt *PackType) BindCBOR(dest interface{}) error {
+	body, e := BodyBytesOf(*pt)
+	if e != nil {
+		return e
+	}
+
+	if e := cbor.Unmarshal(body, dest); e != nil {
+		return newFrameError(ErrBodyDecode, e, "marshaller 'cbor'")
+	}
+	return nil
+}
+func (pt *PackType) BindBSON(dest interface{}) error {
+	body, e := BodyBytesOf(*pt)
+	if e != nil {
+		return e
+	}
+
+	if e := bson.Unmarshal(body, dest); e != nil {
+		return newFrameError(ErrBodyDecode, e, "marshaller 'bson'")
 	}
 	return nil
 }
 
 func (pt *PackType) URLPattern() (string, error) {
 	urlPattern, e := URLPatternOf(*pt)
-
 	if e != nil {
-		return "", errorx.Wrap(e)
+		return "", e
 	}
 	return urlPattern, nil
 }
@@ -80,7 +116,7 @@ func (pt *PackType) URLPattern() (string, error) {
 func (pt *PackType) MessageID() (int32, error) {
 	msid, e := MessageIDOf(*pt)
 	if e != nil {
-		return msid, errorx.Wrap(e)
+		return msid, e
 	}
 	return msid, nil
 }
@@ -22,6 +22,9 @@ var PackTOML = NewPackx(TomlMarshaller{})
 var PackXML = NewPackx(XmlMarshaller{})
 var PackYAML = NewPackx(YamlMarshaller{})
 var PackProtobuf = NewPackx(ProtobufMarshaller{})
+var PackMsgpack = NewPackx(MsgpackMarshaller{})
+var PackCbor = NewPackx(CborMarshaller{})
+var PackBson = NewPackx(BsonMarshaller{})
 
 // New a packx instance, specific a marshaller for communication.
 // If marshaller is nil, official jsonMarshaller is put to used.
@@ -78,6 +81,7 @@ func (packx Packx) PackWithBody(messageID int32, body []byte, headers ...map[str
 //       packx.Unpack(stream, &struct2)
 //     ...
 // }
+// Or register types by RegisterType, and use packx.UnpackAny(stream).
 func (packx Packx) Unpack(stream []byte, dest interface{}) (Message, error) {
 	return UnpackWithMarshaller(stream, dest, packx.Marshaller)
 }
@@ -87,11 +91,8 @@ func (packx Packx) Unpack(stream []byte, dest interface{}) (Message, error) {
 func (packx Packx) FirstBlockOf(r io.Reader) ([]byte, error) {
 	return FirstBlockOf(r)
 }
-func (packx Packx) FirstBlockOfLimitMaxByte(r io.Reader, maxByte int32) ([]byte, error) {
-	if maxByte <= 0 {
-		return FirstBlockOf(r)
-	}
-	return FirstBlockOfLimitMaxByte(r, maxByte)
+func (packx Packx) FirstBlockOfLimitMaxByte(r io.Reader, maxByte int32, limits ...FrameLimits) ([]byte, error) {
+	return FirstBlockOfLimitMaxByte(r, maxByte, limits...)
 }
 
 // returns the first block's messageID, header, body marshalled stream, error.
@@ -124,11 +125,12 @@ func FirstBlockOf(r io.Reader) ([]byte, error) {
 	return UnpackToBlockFromReader(r)
 }
 
-func FirstBlockOfLimitMaxByte(r io.Reader, maxByte int32) ([]byte, error) {
-	if maxByte <= 0 {
+// maxByte <= 0 means no limit of the whole frame, limits are optional.
+func FirstBlockOfLimitMaxByte(r io.Reader, maxByte int32, limits ...FrameLimits) ([]byte, error) {
+	if maxByte <= 0 && (len(limits) == 0 || limits[0].isZero()) {
 		return UnpackToBlockFromReader(r)
 	}
-	return UnpackToBlockFromReaderLimitMaxLengthOfByte(r, int(maxByte))
+	return UnpackToBlockFromReaderLimitMaxLengthOfByte(r, int(maxByte), limits...)
 }
 
 // a stream from a buffer which can be apart by protocol.
@@ -138,12 +140,11 @@ func (packx Packx) FirstBlockOfBytes(buffer []byte) ([]byte, error) {
 }
 func FirstBlockOfBytes(buffer []byte) ([]byte, error) {
 	if len(buffer) < 16 {
-		return nil, errors.New(fmt.Sprintf("require buffer length more than 16 but got %d", len(buffer)))
+		return nil, newFrameError(ErrFrameTooShort, nil, "require buffer length more than 16 but got %d", len(buffer))
 	}
 	var length = binary.BigEndian.Uint32(buffer[0:4])
-	if len(buffer) < 4+int(length) {
-		return nil, errors.New(fmt.Sprintf("require buffer length more than %d but got %d", 4+int(length), len(buffer)))
-
+	if uint64(len(buffer)) < 4+uint64(length) {
+		return nil, newFrameError(ErrFrameTooShort, nil, "require buffer length more than %d but got %d", 4+uint64(length), len(buffer))
 	}
 	return buffer[:4+int(length)], nil
 }
@@ -158,7 +159,7 @@ func (packx Packx) MessageIDOf(stream []byte) (int32, error) {
 // Use this to choose which struct for unpacking.
 func MessageIDOf(stream []byte) (int32, error) {
 	if len(stream) < 8 {
-		return 0, errors.New(fmt.Sprintf("stream lenth should be bigger than 8"))
+		return 0, newFrameError(ErrFrameTooShort, nil, "stream length should be bigger than 8 but got %d", len(stream))
 	}
 	messageID := binary.BigEndian.Uint32(stream[4:8])
 	return int32(messageID), nil
@@ -174,7 +175,7 @@ func (packx Packx) LengthOf(stream []byte) (int32, error) {
 // Length doesn't include length flag itself, it refers to a valid message length after it.
 func LengthOf(stream []byte) (int32, error) {
 	if len(stream) < 4 {
-		return 0, errors.New(fmt.Sprintf("stream lenth should be bigger than 4"))
+		return 0, newFrameError(ErrFrameTooShort, nil, "stream length should be bigger than 4 but got %d", len(stream))
 	}
 	length := binary.BigEndian.Uint32(stream[0:4])
 	return int32(length), nil
@@ -188,7 +189,7 @@ func (packx Packx) HeaderLengthOf(stream []byte) (int32, error) {
 // Header length of a stream received
 func HeaderLengthOf(stream []byte) (int32, error) {
 	if len(stream) < 12 {
-		return 0, errors.New(fmt.Sprintf("stream lenth should be bigger than 12"))
+		return 0, newFrameError(ErrFrameTooShort, nil, "stream length should be bigger than 12 but got %d", len(stream))
 	}
 	headerLength := binary.BigEndian.Uint32(stream[8:12])
 	return int32(headerLength), nil
@@ -202,7 +203,7 @@ func (packx Packx) BodyLengthOf(stream []byte) (int32, error) {
 // Body length of a stream received
 func BodyLengthOf(stream []byte) (int32, error) {
 	if len(stream) < 16 {
-		return 0, errors.New(fmt.Sprintf("stream lenth should be bigger than %d", 16))
+		return 0, newFrameError(ErrFrameTooShort, nil, "stream length should be bigger than 16 but got %d", len(stream))
 	}
 	bodyLength := binary.BigEndian.Uint32(stream[12:16])
 	return int32(bodyLength), nil
@@ -219,10 +220,10 @@ func HeaderBytesOf(stream []byte) ([]byte, error) {
 	if e != nil {
 		return nil, e
 	}
-	if len(stream) < 16+int(headerLen) {
-		return nil, errors.New(fmt.Sprintf("stream lenth should be bigger than %d", 16+int(headerLen)))
+	if uint64(len(stream)) < 16+uint64(uint32(headerLen)) {
+		return nil, newFrameError(ErrFrameTooShort, nil, "stream length should be bigger than %d but got %d", 16+uint64(uint32(headerLen)), len(stream))
 	}
-	header := stream[16 : 16+headerLen]
+	header := stream[16 : 16+int(uint32(headerLen))]
 	return header, nil
 }
 
@@ -236,11 +237,14 @@ func HeaderOf(stream []byte) (map[string]interface{}, error) {
 	var header map[string]interface{}
 	headerBytes, e := HeaderBytesOf(stream)
 	if e != nil {
-		return nil, errorx.Wrap(e)
+		return nil, e
+	}
+	if len(headerBytes) == 0 {
+		return nil, nil
 	}
 	e = json.Unmarshal(headerBytes, &header)
 	if e != nil {
-		return nil, errorx.Wrap(e)
+		return nil, newFrameError(ErrHeaderMalformed, e, "")
 	}
 	return header, nil
 }
@@ -260,10 +264,12 @@ func BodyBytesOf(stream []byte) ([]byte, error) {
 	if e != nil {
 		return nil, e
 	}
-	if len(stream) < 16+int(headerLen)+int(bodyLen) {
-		return nil, errors.New(fmt.Sprintf("stream lenth should be bigger than %d", 16+int(headerLen)+int(bodyLen)))
+	var bodyStart = 16 + uint64(uint32(headerLen))
+	var bodyEnd = bodyStart + uint64(uint32(bodyLen))
+	if uint64(len(stream)) < bodyEnd {
+		return nil, newFrameError(ErrFrameTooShort, nil, "stream length should be bigger than %d but got %d", bodyEnd, len(stream))
 	}
-	body := stream[16+headerLen : 16+headerLen+bodyLen]
+	body := stream[bodyStart:bodyEnd]
 	return body, nil
 }
 
@@ -296,7 +302,7 @@ func PackWithMarshaller(message Message, marshaller Marshaller) ([]byte, error)
 	var bodyLengthBuf = make([]byte, 4)
 	var headerBuf []byte
 	var bodyBuf []byte
-	headerBuf, e = json.Marshal(message.Header)
+	headerBuf, e = json.Marshal(stampPackType(message.Header, marshaller))
 	if e != nil {
 		return nil, e
 	}
@@ -326,22 +332,25 @@ func PackWithMarshaller(message Message, marshaller Marshaller) ([]byte, error)
 	return packet, nil
 }
 
+// stamp marshaller's name in header 'Pack-Content-Type', so that receiver knows how to decode body.
+// Caller's header is not modified, and a name set by caller is kept.
+func stampPackType(header map[string]interface{}, marshaller Marshaller) map[string]interface{} {
+	if _, ok := header[HEADER_PACK_TYPE]; ok {
+		return header
+	}
+	var stamped = make(map[string]interface{}, len(header)+1)
+	for k, v := range header {
+		stamped[k] = v
+	}
+	stamped[HEADER_PACK_TYPE] = marshaller.MarshalName()
+	return stamped
+}
+
 // same as above
 func PackWithMarshallerName(message Message, marshallerName string) ([]byte, error) {
-	var marshaller Marshaller
-	switch marshallerName {
-	case "json":
-		marshaller = JsonMarshaller{}
-	case "xml":
-		marshaller = XmlMarshaller{}
-	case "toml", "tml":
-		marshaller = TomlMarshaller{}
-	case "yaml", "yml":
-		marshaller = YamlMarshaller{}
-	case "protobuf", "proto":
-		marshaller = ProtobufMarshaller{}
-	default:
-		return nil, errors.New("only accept ['json', 'xml', 'toml','yaml','protobuf']")
+	marshaller, e := GetMarshallerByMarshalName(marshallerName)
+	if e != nil {
+		return nil, e
 	}
 	return PackWithMarshaller(message, marshaller)
 }
@@ -355,60 +364,73 @@ func PackWithMarshallerName(message Message, marshallerName string) ([]byte, err
 // [4]byte -- bodyLength         fixed_size,binary big endian encode
 // []byte -- header              marshal by json
 // []byte -- body                marshal by marshaller
+// Errors returned are *FrameError, bad input of any shape returns error rather than panics.
 func UnpackWithMarshaller(stream []byte, dest interface{}, marshaller Marshaller) (Message, error) {
 	if marshaller == nil {
 		marshaller = JsonMarshaller{}
 	}
 	var e error
+	if len(stream) < 16 {
+		return Message{}, newFrameError(ErrFrameTooShort, nil, "stream length should be bigger than 16 but got %d", len(stream))
+	}
 	// 包长
-	length := binary.BigEndian.Uint32(stream[0:4])
+	length := uint64(binary.BigEndian.Uint32(stream[0:4]))
+	if length < 12 || uint64(len(stream)) < length+4 {
+		return Message{}, newFrameError(ErrFrameTooShort, nil, "frame declares length %d but stream has %d bytes", length, len(stream)-4)
+	}
 	stream = stream[0 : length+4]
 	// messageID
 	messageID := binary.BigEndian.Uint32(stream[4:8])
 	// header长度
-	headerLength := binary.BigEndian.Uint32(stream[8:12])
+	headerLength := uint64(binary.BigEndian.Uint32(stream[8:12]))
 	// body长度
-	bodyLength := binary.BigEndian.Uint32(stream[12:16])
+	bodyLength := uint64(binary.BigEndian.Uint32(stream[12:16]))
+	if 16+headerLength+bodyLength > uint64(len(stream)) {
+		return Message{}, newFrameError(ErrFrameTooShort, nil, "header length %d and body length %d exceed frame length %d", headerLength, bodyLength, length)
+	}
 	// header
 	var header map[string]interface{}
 	if headerLength != 0 {
 		e = json.Unmarshal(stream[16:(16 + headerLength)], &header)
 		if e != nil {
-			return Message{}, e
+			return Message{}, newFrameError(ErrHeaderMalformed, e, "")
 		}
 	}
 
 	// body
 	if bodyLength != 0 {
-		e = marshaller.Unmarshal(stream[16+headerLength:(16 + headerLength + bodyLength)], dest)
+		e = unmarshalBody(marshaller, stream[16+headerLength:(16+headerLength+bodyLength)], dest)
 		if e != nil {
-			return Message{}, e
+			return Message{}, newFrameError(ErrBodyDecode, e, "marshaller '%s'", marshaller.MarshalName())
 		}
 	}
 
+	var body interface{}
+	if dest != nil {
+		body = reflect.Indirect(reflect.ValueOf(dest)).Interface()
+	}
 	return Message{
 		MessageID: int32(messageID),
 		Header:    header,
-		Body:      reflect.Indirect(reflect.ValueOf(dest)).Interface(),
+		Body:      body,
 	}, nil
 }
 
+// marshallers of third party might panic on bad input, turn it into error
+func unmarshalBody(marshaller Marshaller, body []byte, dest interface{}) (e error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e = fmt.Errorf("panic when unmarshalling: %v", r)
+		}
+	}()
+	return marshaller.Unmarshal(body, dest)
+}
+
 // same as above
 func UnpackWithMarshallerName(stream []byte, dest interface{}, marshallerName string) (Message, error) {
-	var marshaller Marshaller
-	switch marshallerName {
-	case "json":
-		marshaller = JsonMarshaller{}
-	case "xml":
-		marshaller = XmlMarshaller{}
-	case "toml", "tml":
-		marshaller = TomlMarshaller{}
-	case "yaml", "yml":
-		marshaller = YamlMarshaller{}
-	case "protobuf", "proto":
-		marshaller = ProtobufMarshaller{}
-	default:
-		return Message{}, errors.New("only accept ['json', 'xml', 'toml','yaml','protobuf']")
+	marshaller, e := GetMarshallerByMarshalName(marshallerName)
+	if e != nil {
+		return Message{}, e
 	}
 	return UnpackWithMarshaller(stream, dest, marshaller)
 }
@@ -441,9 +463,9 @@ func UnpackToBlockFromReader(reader io.Reader) ([]byte, error) {
 		return nil, errorx.Wrap(e)
 	}
 
-	length, e := packx.LengthOf(info)
-	if e != nil {
-		return nil, e
+	length := binary.BigEndian.Uint32(info)
+	if length < 12 {
+		return nil, newFrameError(ErrFrameTooShort, nil, "frame declares length %d, less than 12", length)
 	}
 	var content = make([]byte, length, length)
 	if e := readUntil(reader, content); e != nil {
@@ -456,10 +478,17 @@ func UnpackToBlockFromReader(reader io.Reader) ([]byte, error) {
 	return append(info, content ...), nil
 }
 
-func UnpackToBlockFromReaderLimitMaxLengthOfByte(reader io.Reader, maxByTe int) ([]byte, error) {
+// maxByTe <= 0 means no limit of the whole frame.
+// When limits is set, sizes of header and body are checked before allocation, keys and depth of header are checked before parsing,
+// a frame over them returns *LimitError.
+func UnpackToBlockFromReaderLimitMaxLengthOfByte(reader io.Reader, maxByTe int, limits ...FrameLimits) ([]byte, error) {
 	if reader == nil {
 		return nil, errors.New("reader is nil")
 	}
+	var limit FrameLimits
+	if len(limits) > 0 {
+		limit = limits[0]
+	}
 	var info = make([]byte, 4, 4)
 	if e := readUntil(reader, info); e != nil {
 		if e == io.EOF {
@@ -468,24 +497,54 @@ func UnpackToBlockFromReaderLimitMaxLengthOfByte(reader io.Reader, maxByTe int)
 		return nil, errorx.Wrap(e)
 	}
 
-	length, e := packx.LengthOf(info)
-	if e != nil {
-		return nil, e
+	length := binary.BigEndian.Uint32(info)
+	if length < 12 {
+		return nil, newFrameError(ErrFrameTooShort, nil, "frame declares length %d, less than 12", length)
 	}
-
-	if length > int32(maxByTe) {
-		return nil, errorx.NewFromStringf("recv message beyond max byte length limit(%d), got (%d)", maxByTe, length)
+	if maxByTe > 0 && uint64(length) > uint64(maxByTe) {
+		return nil, newFrameError(ErrFrameTooLarge, nil, "recv message beyond max byte length limit(%d), got (%d)", maxByTe, length)
 	}
 
-	var content = make([]byte, length, length)
-	if e := readUntil(reader, content); e != nil {
+	var prefix = make([]byte, 16, 16)
+	copy(prefix, info)
+	if e := readUntil(reader, prefix[4:]); e != nil {
 		if e == io.EOF {
 			return nil, e
 		}
 		return nil, errorx.Wrap(e)
 	}
+	headerLength, _ := HeaderLengthOf(prefix)
+	bodyLength, _ := BodyLengthOf(prefix)
+	// length should be exactly what header and body take, or a frame declaring small header and body could still allocate a huge length
+	if parts := 12 + uint64(uint32(headerLength)) + uint64(uint32(bodyLength)); parts > uint64(length) {
+		return nil, newFrameError(ErrFrameTooShort, nil, "header length %d and body length %d exceed frame length %d", uint32(headerLength), uint32(bodyLength), length)
+	} else if parts < uint64(length) {
+		return nil, newFrameError(ErrFrameTooLarge, nil, "frame length %d exceeds header length %d and body length %d", length, uint32(headerLength), uint32(bodyLength))
+	}
+	if le := limit.checkPrefix(prefix); le != nil {
+		// without max byte, the rest might be endless
+		if limit.Reject && maxByTe > 0 {
+			if e := discardN(reader, int64(length)-12); e != nil {
+				return nil, errorx.Wrap(e)
+			}
+			le.Discarded = true
+		}
+		return nil, le
+	}
 
-	return append(info, content ...), nil
+	var content = make([]byte, 4+length, 4+length)
+	copy(content, prefix)
+	if e := readUntil(reader, content[16:]); e != nil {
+		if e == io.EOF {
+			return nil, e
+		}
+		return nil, errorx.Wrap(e)
+	}
+	if le := limit.checkHeader(int32(binary.BigEndian.Uint32(prefix[4:8])), content[16:16+uint32(headerLength)]); le != nil {
+		le.Discarded = true
+		return nil, le
+	}
+	return content, nil
 }
 
 func readUntil(reader io.Reader, buf []byte) error {
@@ -567,11 +626,11 @@ func PackStuff(messageID int32) []byte {
 func URLPatternOf(stream []byte) (string, error) {
 	header, e := HeaderOf(stream)
 	if e != nil {
-		return "", errorx.Wrap(e)
+		return "", e
 	}
 	str, _, e := headerGetString(header, HEADER_ROUTER_VALUE)
 	if e != nil {
-		return "", errorx.Wrap(e)
+		return "", e
 	}
 	return str, nil
 }
@@ -579,11 +638,11 @@ func URLPatternOf(stream []byte) (string, error) {
 func RouteTypeOf(stream []byte) (string, error) {
 	header, e := HeaderOf(stream)
 	if e != nil {
-		return "", errorx.Wrap(e)
+		return "", e
 	}
 	str, _, e := headerGetString(header, HEADER_ROUTER_KEY)
 	if e != nil {
-		return "", errorx.Wrap(e)
+		return "", e
 	}
 
 	return str, nil
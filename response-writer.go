@@ -0,0 +1,133 @@
+package tcpx
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+// ## introduction:
+// Replies of a request go through ctx's ResponseWriter, middlewares wrap it to inspect, rewrite or suppress outbound frames:
+/*
+   srv.UseGlobal(func(c *tcpx.Context) {
+       next := c.Writer()
+       c.SetWriter(tcpx.ResponseWriterFunc(func(frame []byte) error {
+           frame, e := tcpx.SetFrameHeader(frame, map[string]interface{}{"Server-Time": time.Now().Unix()})
+           if e != nil {
+               return e
+           }
+           return next.WriteFrame(frame)
+       }))
+   })
+*/
+// A writer not calling next suppresses the frame. Writers set later run earlier, the same as middlewares wrapping handlers.
+// Replies by c.Reply, c.JSON, c.ReplyError, c.StreamWriter... and automatic error frames all go through it.
+// Frames not replying the request don't, like c.Request to client and frames rejected by limits before routing.
+//
+// After hooks run when the handler chain finishes, even aborted or panicked, in reverse order of registration, like defer:
+/*
+   srv.UseGlobal(func(c *tcpx.Context) {
+       start := time.Now()
+       c.After(func(c *tcpx.Context) {
+           log.Println(c.ReplyStatus(), c.Err(), time.Since(start))
+       })
+   })
+*/
+// Handlers report errors by c.Error(e), c.ReplyError(code, e) or returning them in tcpx.Handle, hooks see the first by c.Err().
+
+// ResponseWriter writes outbound frames replying a request.
+type ResponseWriter interface {
+	WriteFrame(frame []byte) error
+}
+
+// ResponseWriterFunc makes a function a ResponseWriter.
+type ResponseWriterFunc func(frame []byte) error
+
+func (f ResponseWriterFunc) WriteFrame(frame []byte) error {
+	return f(frame)
+}
+
+// Writer returns the current ResponseWriter of ctx, writers wrapping it should call it to send frames.
+func (ctx *Context) Writer() ResponseWriter {
+	if ctx.writer != nil {
+		return ctx.writer
+	}
+	return ResponseWriterFunc(ctx.writeFrame)
+}
+
+// SetWriter replaces the ResponseWriter of ctx, it works for the request of ctx only.
+func (ctx *Context) SetWriter(w ResponseWriter) {
+	ctx.writer = w
+}
+
+// After adds a hook run when the handler chain of the request finishes.
+// Hooks added out of a handler chain, like in OnConnect, never run.
+func (ctx *Context) After(hooks ...func(c *Context)) {
+	ctx.afters = append(ctx.afters, hooks...)
+}
+
+// Error records an error of the request for after hooks, only the first is kept.
+func (ctx *Context) Error(err error) {
+	if err != nil && ctx.err == nil {
+		ctx.err = err
+	}
+}
+
+// Err returns the first error recorded by ctx.Error.
+func (ctx *Context) Err() error {
+	return ctx.err
+}
+
+// ReplyStatus returns 'Error-Code' of the last frame replied when it's an error frame, OK for other frames,
+// and 0 when nothing is replied. Frames suppressed by writers are not counted.
+func (ctx *Context) ReplyStatus() int {
+	return int(atomic.LoadInt32(&ctx.replyStatus))
+}
+
+func (ctx *Context) recordReplyStatus(frame []byte) {
+	var status = OK
+	if se := StatusErrorOf(frame); se != nil {
+		status = se.Code
+	}
+	atomic.StoreInt32(&ctx.replyStatus, int32(status))
+}
+
+// run after hooks in reverse order, a panic of a hook doesn't stop the others
+func (ctx *Context) runAfters() {
+	afters := ctx.afters
+	ctx.afters = nil
+	for i := len(afters) - 1; i >= 0; i-- {
+		func() {
+			defer func() {
+				if e := recover(); e != nil {
+					Logger.Println(fmt.Sprintf("recover from after hook panic %v", e))
+				}
+			}()
+			afters[i](ctx)
+		}()
+	}
+}
+
+// SetFrameHeader adds header to a packed frame, body bytes are kept as they are.
+func SetFrameHeader(frame []byte, header map[string]interface{}) ([]byte, error) {
+	messageID, e := MessageIDOf(frame)
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+	h, e := HeaderOf(frame)
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+	body, e := BodyBytesOf(frame)
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+	if h == nil {
+		h = make(map[string]interface{})
+	}
+	for k, v := range header {
+		h[k] = v
+	}
+	return PackWithMarshallerAndBody(Message{MessageID: messageID, Header: h}, body)
+}
@@ -0,0 +1,125 @@
+package tcpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestContext_ResponseWriter(t *testing.T) {
+	type record struct {
+		messageID int32
+		status    int
+		err       error
+		bytes     int
+	}
+	var l sync.Mutex
+	var records = make(chan record, 10)
+
+	srv := NewTcpX(JsonMarshaller{})
+	srv.UseGlobal(func(c *Context) {
+		var bytes int
+		next := c.Writer()
+		c.SetWriter(ResponseWriterFunc(func(frame []byte) error {
+			l.Lock()
+			bytes += len(frame)
+			l.Unlock()
+			return next.WriteFrame(frame)
+		}))
+		c.After(func(c *Context) {
+			messageID, _ := MessageIDOf(c.Stream)
+			l.Lock()
+			defer l.Unlock()
+			records <- record{messageID: messageID, status: c.ReplyStatus(), err: c.Err(), bytes: bytes}
+		})
+	}, func(c *Context) {
+		next := c.Writer()
+		c.SetWriter(ResponseWriterFunc(func(frame []byte) error {
+			frame, e := SetFrameHeader(frame, map[string]interface{}{"Server": "tcpx"})
+			if e != nil {
+				return e
+			}
+			return next.WriteFrame(frame)
+		}))
+	})
+
+	var errBadName = errors.New("bad name")
+	srv.AddHandler(1, func(c *Context) {
+		c.Reply(1, "hello")
+	})
+	srv.AddHandler(2, func(c *Context) {
+		c.ReplyError(CLIENT_ERROR, errBadName)
+	})
+	srv.AddHandler(3, func(c *Context) {
+		// suppress replies
+		c.SetWriter(ResponseWriterFunc(func(frame []byte) error {
+			return nil
+		}))
+		c.Reply(3, "hidden")
+	})
+	srv.AddHandler(4, func(c *Context) {
+		panic("boom")
+	})
+	go srv.ListenAndServe("tcp", ":7027")
+	time.Sleep(500 * time.Millisecond)
+
+	client, e := Dial("tcp", "localhost:7027", JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+	client.Timeout = 3 * time.Second
+
+	var next = func() record {
+		select {
+		case r := <-records:
+			return r
+		case <-time.After(3 * time.Second):
+			t.Fatal("after hook not run")
+		}
+		return record{}
+	}
+
+	message, e := client.CallAny(context.Background(), 1, nil)
+	if e != nil || message.Header["Server"] != "tcpx" {
+		fmt.Println(fmt.Sprintf("writer should add header 'Server' but got %v, %v", message.Header, e))
+		t.Fail()
+	}
+	if r := next(); r.messageID != 1 || r.status != OK || r.err != nil || r.bytes == 0 {
+		fmt.Println(fmt.Sprintf("messageID 1 want status OK and bytes counted but got %+v", r))
+		t.Fail()
+	}
+
+	var se *StatusError
+	if e := client.Call(context.Background(), 2, nil, nil); !errors.As(e, &se) || se.Code != CLIENT_ERROR {
+		fmt.Println(fmt.Sprintf("messageID 2 want CLIENT_ERROR but got %v", e))
+		t.Fail()
+	}
+	if r := next(); r.status != CLIENT_ERROR || r.err != errBadName {
+		fmt.Println(fmt.Sprintf("messageID 2 want status CLIENT_ERROR and errBadName but got %+v", r))
+		t.Fail()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	if e := client.Call(ctx, 3, nil, nil); !errors.Is(e, context.DeadlineExceeded) {
+		fmt.Println(fmt.Sprintf("messageID 3 reply should be suppressed but got %v", e))
+		t.Fail()
+	}
+	cancel()
+	if r := next(); r.status != 0 || r.bytes != 0 {
+		fmt.Println(fmt.Sprintf("messageID 3 want nothing replied but got %+v", r))
+		t.Fail()
+	}
+
+	if e := client.Call(context.Background(), 4, nil, nil); !errors.As(e, &se) || se.Code != SERVER_ERROR {
+		fmt.Println(fmt.Sprintf("messageID 4 want SERVER_ERROR but got %v", e))
+		t.Fail()
+	}
+	if r := next(); r.status != SERVER_ERROR || r.err == nil {
+		fmt.Println(fmt.Sprintf("messageID 4 want status SERVER_ERROR and panic error but got %+v", r))
+		t.Fail()
+	}
+}
@@ -0,0 +1,366 @@
+package tcpx
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+// ## introduction:
+// A messageID can have conditional routes, which are chosen by values of the frame:
+/*
+   srv.AddHandler(100, sayHelloV2, tcpx.WhenHeader("App-Version", ">=2.3"))
+   srv.AddHandler(100, sayHelloIOS, tcpx.WhenHeader("Platform", "/^(ios|ipados)$/"))
+   srv.AddHandler(100, sayHello)
+*/
+// Or by srv.When, which takes custom matchers too:
+/*
+   srv.When(tcpx.MatchHeader("App-Version", ">=2.3"), myMatcher).AddHandler(100, sayHelloV2)
+*/
+// Conditional routes are tried in order of registration, and the first one whose matchers all match handles the frame.
+// When none matches, the frame goes to the unconditioned handler, or srv.NoMessageID when it's not set.
+// Each conditional route has its own self-related middlewares, and anchor middlewares working when it's registered.
+//
+// Patterns of MatchHeader:
+//   - '/expr/' matches values by regular expression 'expr'.
+//   - '>=2.3', '<3', '=1.2.0', '!=2.0.1' compare values as semantic versions, separate constraints by space or comma and all of them should be met: '>=2.3 <3'.
+//   - Else, values should be equal to the pattern.
+// Frames without the header, or with a header not in form of version for version patterns, don't match.
+// The header of a frame is parsed once however many matchers read it, see ctx.streamHeader().
+//
+// Custom matchers implement Matcher.
+//
+// Handlers made by WhenHeader are recognized by AddHandler by their identity, see matcherHandler, they can be anywhere among handlers.
+// Routes of url-pattern and srv.ReplaceHandler don't take them.
+
+// Matcher decides whether a frame goes to a conditional route.
+type Matcher interface {
+	Match(c *Context) bool
+	// description of matcher, listed by srv.Routes()
+	String() string
+}
+
+// ConditionalRoutes adds routes chosen by matchers, made by srv.When.
+type ConditionalRoutes struct {
+	tcpx     *TcpX
+	matchers []Matcher
+}
+
+// When makes routes added by it handle frames matching all matchers.
+func (tcpx *TcpX) When(matchers ...Matcher) *ConditionalRoutes {
+	if len(matchers) == 0 {
+		panic(errorx.NewFromString("tcpx.When requires at least one matcher"))
+	}
+	for _, m := range matchers {
+		if m == nil {
+			panic(errorx.NewFromString("tcpx.When requires matchers not nil"))
+		}
+	}
+	return &ConditionalRoutes{tcpx: tcpx, matchers: append([]Matcher(nil), matchers...)}
+}
+
+// AddHandler adds a conditional route of messageID, the last of handlers is the handler, the same as srv.AddHandler.
+func (cr *ConditionalRoutes) AddHandler(messageID int32, handlers ...func(c *Context)) {
+	if IsReservedMessageID(messageID) {
+		panic(reservedMessageIDError(messageID))
+	}
+	if len(handlers) <= 0 {
+		panic(errorx.NewFromStringf("handlers should more than 1 but got %d", len(handlers)))
+	}
+	if cr.tcpx.Mux == nil {
+		cr.tcpx.Mux = NewMux()
+	}
+	cr.tcpx.Mux.addMessageIDCandidate(messageID, cr.tcpx.Mux.CurrentAnchorIndex(), cr.matchers, handlers)
+}
+
+// MatchHeader matches frames whose header key matches pattern, see introduction for forms of pattern.
+func MatchHeader(key string, pattern string) Matcher {
+	m, e := newHeaderMatcher(key, pattern)
+	if e != nil {
+		panic(e)
+	}
+	return m
+}
+
+// WhenHeader makes the route of srv.AddHandler conditional, the same as srv.When(tcpx.MatchHeader(key, pattern)).
+func WhenHeader(key string, pattern string) func(c *Context) {
+	return matcherHandler(MatchHeader(key, pattern))
+}
+
+// handlers made by matcherHandler, keyed by their closures, which are kept alive so that addresses are never reused.
+var matcherHandlers sync.Map
+
+// a handler carrying m, AddHandler takes it out of handlers by its identity rather than calling it.
+// When it runs anyway, like wrapped by another handler, it works as a guard, frames not matching go to NotFound.
+func matcherHandler(m Matcher) func(c *Context) {
+	f := func(c *Context) {
+		if !m.Match(c) {
+			c.Abort()
+			NotFound(c)
+		}
+	}
+	matcherHandlers.Store(funcIdentity(f), m)
+	return f
+}
+
+// address of the closure of f, unlike reflect.Value.Pointer(), which is shared by all closures of the same function.
+func funcIdentity(f func(c *Context)) unsafe.Pointer {
+	return *(*unsafe.Pointer)(unsafe.Pointer(&f))
+}
+
+// take handlers made by matcherHandler out of handlers
+func splitMatchers(handlers []func(c *Context)) ([]Matcher, []func(c *Context)) {
+	var matchers []Matcher
+	var rest = make([]func(c *Context), 0, len(handlers))
+	for _, h := range handlers {
+		if h != nil {
+			if m, ok := matcherHandlers.Load(funcIdentity(h)); ok {
+				matchers = append(matchers, m.(Matcher))
+				continue
+			}
+		}
+		rest = append(rest, h)
+	}
+	return matchers, rest
+}
+
+// a conditional route of messageID
+type routeCandidate struct {
+	matchers        []Matcher
+	handler         func(c *Context)
+	selfMiddlewares []func(c *Context)
+	anchorIndex     int
+	// where the route is registered
+	whereis string
+}
+
+func newRouteCandidate(anchorIndex int, matchers []Matcher, handlers []func(c *Context)) routeCandidate {
+	return routeCandidate{
+		matchers:        matchers,
+		handler:         handlers[len(handlers)-1],
+		selfMiddlewares: copyHandlers(handlers[:len(handlers)-1]),
+		anchorIndex:     anchorIndex,
+		whereis:         callerLocation(),
+	}
+}
+
+func (rc routeCandidate) match(c *Context) bool {
+	for _, m := range rc.matchers {
+		if !m.Match(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func (rc routeCandidate) conditions() []string {
+	var conditions = make([]string, 0, len(rc.matchers))
+	for _, m := range rc.matchers {
+		conditions = append(conditions, m.String())
+	}
+	return conditions
+}
+
+// candidates of the same conditions conflict, regardless of order of matchers
+func (rc routeCandidate) sameConditions(rc2 routeCandidate) bool {
+	c1, c2 := rc.conditions(), rc2.conditions()
+	sort.Strings(c1)
+	sort.Strings(c2)
+	return strings.Join(c1, "\n") == strings.Join(c2, "\n")
+}
+
+type headerMatcher struct {
+	key     string
+	pattern string
+	match   func(value string) bool
+}
+
+func newHeaderMatcher(key string, pattern string) (*headerMatcher, error) {
+	m := &headerMatcher{key: key, pattern: pattern}
+	switch {
+	case len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/"):
+		reg, e := regexp.Compile(pattern[1 : len(pattern)-1])
+		if e != nil {
+			return nil, errorx.Wrap(e)
+		}
+		m.match = reg.MatchString
+	case strings.HasPrefix(pattern, ">") || strings.HasPrefix(pattern, "<") || strings.HasPrefix(pattern, "=") || strings.HasPrefix(pattern, "!="):
+		constraints, e := parseVersionConstraints(pattern)
+		if e != nil {
+			return nil, errorx.Wrap(e)
+		}
+		m.match = func(value string) bool {
+			v, ok := parseVersion(value)
+			if !ok {
+				return false
+			}
+			for _, c := range constraints {
+				if !c.check(v) {
+					return false
+				}
+			}
+			return true
+		}
+	default:
+		m.match = func(value string) bool {
+			return value == pattern
+		}
+	}
+	return m, nil
+}
+
+func (m *headerMatcher) Match(c *Context) bool {
+	header, e := c.streamHeader()
+	if e != nil {
+		return false
+	}
+	value, ok := header[m.key]
+	if !ok || value == nil {
+		return false
+	}
+	s, ok := value.(string)
+	if !ok {
+		s = fmt.Sprintf("%v", value)
+	}
+	return m.match(s)
+}
+
+func (m *headerMatcher) String() string {
+	return fmt.Sprintf("header %s %s", m.key, m.pattern)
+}
+
+// semantic version, like 'v2.3.1-beta.1+build', missing minor and patch are 0.
+type version struct {
+	core [3]int
+	pre  []string
+}
+
+func parseVersion(s string) (version, bool) {
+	var v version
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "v"), "V")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		if i == len(s)-1 {
+			return v, false
+		}
+		v.pre = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, false
+	}
+	for i, p := range parts {
+		n, e := strconv.Atoi(p)
+		if e != nil || n < 0 {
+			return v, false
+		}
+		v.core[i] = n
+	}
+	return v, true
+}
+
+// -1 when v < v2, 0 when v == v2, 1 when v > v2, build metadata is ignored.
+func (v version) compare(v2 version) int {
+	for i := range v.core {
+		if v.core[i] != v2.core[i] {
+			return compareInt(v.core[i], v2.core[i])
+		}
+	}
+	// a pre-release is lower than its normal version
+	switch {
+	case len(v.pre) == 0 && len(v2.pre) == 0:
+		return 0
+	case len(v.pre) == 0:
+		return 1
+	case len(v2.pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.pre) && i < len(v2.pre); i++ {
+		n1, e1 := strconv.Atoi(v.pre[i])
+		n2, e2 := strconv.Atoi(v2.pre[i])
+		switch {
+		case e1 == nil && e2 == nil:
+			if n1 != n2 {
+				return compareInt(n1, n2)
+			}
+		// numeric identifiers are lower than alphanumeric ones
+		case e1 == nil:
+			return -1
+		case e2 == nil:
+			return 1
+		default:
+			if c := strings.Compare(v.pre[i], v2.pre[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInt(len(v.pre), len(v2.pre))
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+type versionConstraint struct {
+	op string
+	v  version
+}
+
+// '>=2.3 <3' or '>=2.3,<3'
+func parseVersionConstraints(pattern string) ([]versionConstraint, error) {
+	var constraints []versionConstraint
+	for _, field := range strings.FieldsFunc(pattern, func(r rune) bool { return r == ' ' || r == ',' }) {
+		var c versionConstraint
+		for _, op := range []string{">=", "<=", "!=", ">", "<", "="} {
+			if strings.HasPrefix(field, op) {
+				c.op = op
+				break
+			}
+		}
+		if c.op == "" {
+			return nil, errorx.NewFromStringf("version constraint '%s' of '%s' requires an operator of >=, <=, !=, >, <, =", field, pattern)
+		}
+		v, ok := parseVersion(field[len(c.op):])
+		if !ok {
+			return nil, errorx.NewFromStringf("version constraint '%s' of '%s' has a malformed version", field, pattern)
+		}
+		c.v = v
+		constraints = append(constraints, c)
+	}
+	if len(constraints) == 0 {
+		return nil, errorx.NewFromStringf("version pattern '%s' has no constraint", pattern)
+	}
+	return constraints, nil
+}
+
+func (c versionConstraint) check(v version) bool {
+	n := v.compare(c.v)
+	switch c.op {
+	case ">=":
+		return n >= 0
+	case "<=":
+		return n <= 0
+	case "!=":
+		return n != 0
+	case ">":
+		return n > 0
+	case "<":
+		return n < 0
+	}
+	return n == 0
+}
@@ -0,0 +1,208 @@
+package tcpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVersionCompare(t *testing.T) {
+	var cases = []struct {
+		v1, v2 string
+		want   int
+	}{
+		{"2.3", "2.3.0", 0},
+		{"v2.3.1", "2.3", 1},
+		{"2.10", "2.9.9", 1},
+		{"1.0.0-alpha", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.beta", "1.0.0-alpha.1", 1},
+		{"1.0.0-beta.11", "1.0.0-beta.2", 1},
+		{"1.0.0+build.1", "1.0.0", 0},
+	}
+	for _, c := range cases {
+		v1, ok1 := parseVersion(c.v1)
+		v2, ok2 := parseVersion(c.v2)
+		if !ok1 || !ok2 {
+			t.Fatal(fmt.Sprintf("parse '%s' '%s' fail", c.v1, c.v2))
+		}
+		if got := v1.compare(v2); got != c.want {
+			fmt.Println(fmt.Sprintf("compare '%s' '%s' want %d but got %d", c.v1, c.v2, c.want, got))
+			t.Fail()
+		}
+	}
+	for _, v := range []string{"", "a.b", "1.2.3.4", "1.-2", "1.0-"} {
+		if _, ok := parseVersion(v); ok {
+			fmt.Println(fmt.Sprintf("'%s' should not be a version", v))
+			t.Fail()
+		}
+	}
+}
+
+func TestHeaderMatcher(t *testing.T) {
+	var cases = []struct {
+		pattern string
+		value   interface{}
+		want    bool
+	}{
+		{">=2.3", "2.3.0", true},
+		{">=2.3", "2.2.9", false},
+		{">=2.3 <3", "2.9", true},
+		{">=2.3,<3", "3.0.0", false},
+		{"!=2.0.1", "2.0.1", false},
+		{"=2", "v2.0.0", true},
+		{">=2.3", "latest", false},
+		{"/^(ios|ipados)$/", "ipados", true},
+		{"/^(ios|ipados)$/", "android", false},
+		{"ios", "ios", true},
+		{"ios", "IOS", false},
+		{"3", 3, true},
+	}
+	for _, c := range cases {
+		m, e := newHeaderMatcher("Key", c.pattern)
+		if e != nil {
+			t.Fatal(e.Error())
+		}
+		stream, e := PackWithMarshaller(Message{MessageID: 1, Header: map[string]interface{}{"Key": c.value}}, nil)
+		if e != nil {
+			t.Fatal(e.Error())
+		}
+		if got := m.Match(&Context{Stream: stream}); got != c.want {
+			fmt.Println(fmt.Sprintf("pattern '%s' with '%v' want %v but got %v", c.pattern, c.value, c.want, got))
+			t.Fail()
+		}
+	}
+	for _, pattern := range []string{">=x", "/(/", ">=2 3"} {
+		if _, e := newHeaderMatcher("Key", pattern); e == nil {
+			fmt.Println(fmt.Sprintf("pattern '%s' should be malformed", pattern))
+			t.Fail()
+		}
+	}
+}
+
+func TestSplitMatchers(t *testing.T) {
+	var handler = func(c *Context) {}
+	var when = WhenHeader("App-Version", ">=2.3")
+	// a wrapper is an ordinary handler, it's not taken as a matcher
+	var wrapped = func(c *Context) { when(c) }
+	matchers, rest := splitMatchers([]func(c *Context){handler, when, wrapped, WhenHeader("Channel", "beta")})
+	if len(matchers) != 2 || matchers[0].String() != "header App-Version >=2.3" || matchers[1].String() != "header Channel beta" || len(rest) != 2 {
+		fmt.Println(fmt.Sprintf("want 2 matchers and 2 handlers but got %v, %d", matchers, len(rest)))
+		t.Fail()
+	}
+	// closures of the same function are told apart
+	if matchers, _ := splitMatchers([]func(c *Context){when, when}); len(matchers) != 2 {
+		fmt.Println(fmt.Sprintf("a matcher handler reused should be taken each time, got %v", matchers))
+		t.Fail()
+	}
+}
+
+func TestContext_StreamHeader(t *testing.T) {
+	stream, e := PackWithMarshaller(Message{MessageID: 1, Header: map[string]interface{}{"Key": "v1"}}, nil)
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	ctx := &Context{Stream: stream}
+	h1, e := ctx.streamHeader()
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	// a cached header is returned as it is, mark it to tell
+	h1["Cached"] = true
+	h2, _ := ctx.streamHeader()
+	if h2["Cached"] != true {
+		fmt.Println(fmt.Sprintf("header of the same stream should be parsed once, got %v", h2))
+		t.Fail()
+	}
+
+	ctx.Stream, e = PackWithMarshaller(Message{MessageID: 1, Header: map[string]interface{}{"Key": "v2"}}, nil)
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	h3, _ := ctx.streamHeader()
+	if h3["Key"] != "v2" || h3["Cached"] != nil {
+		fmt.Println(fmt.Sprintf("header of a new stream should be parsed again, got %v", h3))
+		t.Fail()
+	}
+}
+
+func TestTcpX_When(t *testing.T) {
+	srv := NewTcpX(JsonMarshaller{})
+	var reply = func(s string) func(c *Context) {
+		return func(c *Context) {
+			c.Reply(100, s)
+		}
+	}
+	srv.When(MatchHeader("App-Version", ">=2.3")).AddHandler(100, reply("v2"))
+	// matchers can be anywhere among handlers
+	srv.AddHandler(100, WhenHeader("Platform", "/^(ios|ipados)$/"), reply("ios"))
+	srv.AddHandler(100, reply("v1"))
+	srv.AddHandler(101, reply("beta"), WhenHeader("Channel", "beta"))
+	go srv.ListenAndServe("tcp", ":7026")
+	time.Sleep(500 * time.Millisecond)
+
+	client, e := Dial("tcp", "localhost:7026", JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+	client.Timeout = 3 * time.Second
+
+	var cases = []struct {
+		messageID int32
+		header    map[string]interface{}
+		want      string
+	}{
+		{100, map[string]interface{}{"App-Version": "2.4.1", "Platform": "ios"}, "v2"},
+		{100, map[string]interface{}{"App-Version": "2.2", "Platform": "ios"}, "ios"},
+		{100, map[string]interface{}{"App-Version": "2.2"}, "v1"},
+		{100, nil, "v1"},
+		{101, map[string]interface{}{"Channel": "beta"}, "beta"},
+	}
+	for _, c := range cases {
+		var got string
+		var headers []map[string]interface{}
+		if c.header != nil {
+			headers = append(headers, c.header)
+		}
+		if e := client.Call(context.Background(), c.messageID, nil, &got, headers...); e != nil || got != c.want {
+			fmt.Println(fmt.Sprintf("messageID %d with %v want '%s' but got '%s', %v", c.messageID, c.header, c.want, got, e))
+			t.Fail()
+		}
+	}
+	// no unconditioned handler, falls back to NoMessageID
+	if e := client.Call(context.Background(), 101, nil, nil); !errors.Is(e, ErrUnknownRoute) {
+		fmt.Println(fmt.Sprintf("unmatched messageID 101 want not-found but got %v", e))
+		t.Fail()
+	}
+
+	if e := panicOf(func() { srv.When(MatchHeader("App-Version", ">=2.3")).AddHandler(100, reply("v3")) }); !errors.Is(e, ErrRouteConflict) {
+		fmt.Println(fmt.Sprintf("same conditions want ErrRouteConflict but got %v", e))
+		t.Fail()
+	}
+	if e := panicOf(func() { srv.AddHandler(100, reply("v3"), WhenHeader("App-Version", ">=2.3")) }); !errors.Is(e, ErrRouteConflict) {
+		fmt.Println(fmt.Sprintf("same conditions by WhenHeader want ErrRouteConflict but got %v", e))
+		t.Fail()
+	}
+	if e := panicOf(func() { srv.Any("/when/", reply("v2"), WhenHeader("App-Version", ">=2.3")) }); e == nil {
+		fmt.Println("url-pattern routes should reject matchers")
+		t.Fail()
+	}
+	if e := srv.ReplaceHandler(100, reply("v2"), WhenHeader("App-Version", ">=2.3")); e == nil {
+		fmt.Println("ReplaceHandler should reject matchers")
+		t.Fail()
+	}
+	for _, matchers := range [][]Matcher{nil, {nil}} {
+		if e := panicOf(func() { srv.When(matchers...) }); e == nil {
+			fmt.Println(fmt.Sprintf("srv.When(%v) should panic", matchers))
+			t.Fail()
+		}
+	}
+	routes := srv.Routes()
+	if len(routes) != 4 || len(routes[0].Conditions) != 1 || routes[0].Conditions[0] != "header App-Version >=2.3" || len(routes[2].Conditions) != 0 {
+		fmt.Println(fmt.Sprintf("routes should list conditional routes first, got %+v", routes))
+		t.Fail()
+	}
+}
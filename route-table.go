@@ -0,0 +1,280 @@
+package tcpx
+
+import (
+	"errors"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+// ## introduction:
+// Routes and middlewares can be changed while server is running:
+/*
+   srv.ReplaceHandler(1, newSayHello)
+   srv.RemoveHandler(2)
+   srv.RemoveRoute("/game/room/join/")
+   srv.DisableMiddleware("anchor-auth")
+   srv.EnableMiddleware("anchor-auth")
+*/
+// Mux keeps its maps for registration, and publishes a read-only copy, routeTable, for handler goroutines.
+// Changes only mark the published copy stale, and the copy is rebuilt once when the next frame is routed,
+// so registering many routes at startup doesn't rebuild routes for each of them.
+// Handler goroutines only read the latest published copy, so they don't lock unless it's stale, and a frame is routed by one
+// consistent version of routes. Frames being handled when routes change keep running on the version they started with.
+
+// returned when removing or replacing a route that doesn't exist
+var ErrRouteNotFound = errors.New("tcpx: route not found")
+
+// routeTable is a read-only copy of a mux. Never modify it after it's published.
+type routeTable struct {
+	handlers         map[int32]func(c *Context)
+	selfMiddlewares  map[int32][]func(c *Context)
+	messageIDAnchors map[int32]int
+	// conditional routes, tried before handlers
+	messageIDCandidates map[int32][]routeCandidate
+
+	urlHandlers map[string][]func(c *Context)
+	urlAnchors  map[string]int
+	tree        *urlTree
+
+	globals []func(c *Context)
+	// enabled anchor middlewares
+	anchors []MiddlewareAnchor
+	// enabled conditional middlewares of routes
+	messageIDWhens map[int32][]whenMiddleware
+	urlWhens       map[string][]whenMiddleware
+
+	noRoute     []func(c *Context)
+	noMessageID []func(c *Context)
+}
+
+// mark the published routeTable stale after a change, it's rebuilt by the next mux.routes(). Caller must hold mux.Mutex.
+func (mux *Mux) publish() {
+	mux.table.Store((*routeTable)(nil))
+}
+
+// copy mux into a new routeTable, caller must hold mux.Mutex.
+func (mux *Mux) buildRouteTable() *routeTable {
+	rt := &routeTable{
+		handlers:         make(map[int32]func(c *Context), len(mux.Handlers)),
+		selfMiddlewares:  make(map[int32][]func(c *Context), len(mux.MessageIDSelfMiddleware)),
+		messageIDAnchors: make(map[int32]int, len(mux.MessageIDAnchorMap)),
+		urlHandlers:      make(map[string][]func(c *Context), len(mux.urlMux.urlPatternMux)),
+		urlAnchors:       make(map[string]int, len(mux.urlMux.URLAnchorMap)),
+		tree:             newURLTree(),
+		globals:          copyHandlers(mux.GlobalMiddlewares),
+		anchors:          make([]MiddlewareAnchor, 0, len(mux.MiddlewareAnchors)),
+		noRoute:          copyHandlers(mux.noRoute),
+		noMessageID:      copyHandlers(mux.noMessageID),
+	}
+	for k, v := range mux.Handlers {
+		rt.handlers[k] = v
+	}
+	for k, v := range mux.MessageIDSelfMiddleware {
+		rt.selfMiddlewares[k] = copyHandlers(v)
+	}
+	for k, v := range mux.MessageIDAnchorMap {
+		rt.messageIDAnchors[k] = v.AnchorIndex
+	}
+	if len(mux.messageIDCandidates) > 0 {
+		rt.messageIDCandidates = make(map[int32][]routeCandidate, len(mux.messageIDCandidates))
+		for k, v := range mux.messageIDCandidates {
+			rt.messageIDCandidates[k] = append([]routeCandidate(nil), v...)
+		}
+	}
+	for k, v := range mux.urlMux.urlPatternMux {
+		rt.urlHandlers[k] = copyHandlers(v)
+		rt.tree.insert(k)
+	}
+	for k, v := range mux.urlMux.URLAnchorMap {
+		rt.urlAnchors[k] = v.AnchorIndex
+	}
+	if len(mux.whenMiddlewares) > 0 {
+		rt.messageIDWhens = make(map[int32][]whenMiddleware)
+		rt.urlWhens = make(map[string][]whenMiddleware)
+		for k := range mux.Handlers {
+			rt.messageIDWhens[k] = mux.resolveWhenMiddlewares(RouteKey{MessageID: k})
+		}
+		for k := range mux.messageIDCandidates {
+			rt.messageIDWhens[k] = mux.resolveWhenMiddlewares(RouteKey{MessageID: k})
+		}
+		for k := range mux.urlMux.urlPatternMux {
+			rt.urlWhens[k] = mux.resolveWhenMiddlewares(RouteKey{URLPattern: k})
+		}
+	}
+	for _, v := range mux.MiddlewareAnchors {
+		if mux.disabledMiddlewares[v.MiddlewareKey] {
+			continue
+		}
+		// index ranges are appended by later Use/UnUse, don't share them
+		v.AnchorStartIndexRange = append([]int(nil), v.AnchorStartIndexRange...)
+		v.AnchorEndIndexRange = append([]int(nil), v.AnchorEndIndexRange...)
+		rt.anchors = append(rt.anchors, v)
+	}
+	return rt
+}
+
+// latest published routeTable, rebuilt when it's stale
+func (mux *Mux) routes() *routeTable {
+	if rt, _ := mux.table.Load().(*routeTable); rt != nil {
+		return rt
+	}
+	mux.Mutex.Lock()
+	defer mux.Mutex.Unlock()
+	return mux.routesLocked()
+}
+
+// the same as mux.routes(), caller must hold mux.Mutex
+func (mux *Mux) routesLocked() *routeTable {
+	if rt, _ := mux.table.Load().(*routeTable); rt != nil {
+		return rt
+	}
+	rt := mux.buildRouteTable()
+	mux.table.Store(rt)
+	return rt
+}
+
+// anchor middlewares working for a route whose anchor index is anchorIndex
+func (rt *routeTable) anchorMiddlewares(anchorIndex int) []func(c *Context) {
+	var mids []func(c *Context)
+	for i := range rt.anchors {
+		if rt.anchors[i].Contains(anchorIndex) {
+			mids = append(mids, rt.anchors[i].Middleware)
+		}
+	}
+	return mids
+}
+
+// all enabled anchor middlewares
+func (rt *routeTable) allAnchorMiddlewares() []func(c *Context) {
+	var mids = make([]func(c *Context), 0, len(rt.anchors))
+	for i := range rt.anchors {
+		mids = append(mids, rt.anchors[i].Middleware)
+	}
+	return mids
+}
+
+// handler, self-related middlewares and anchor index of messageID for ctx.
+// The first conditional route matching ctx is chosen, else the unconditioned handler.
+func (rt *routeTable) messageIDRoute(ctx *Context, messageID int32) (func(c *Context), []func(c *Context), int, bool) {
+	for _, candidate := range rt.messageIDCandidates[messageID] {
+		if candidate.match(ctx) {
+			return candidate.handler, candidate.selfMiddlewares, candidate.anchorIndex, true
+		}
+	}
+	handler, ok := rt.handlers[messageID]
+	return handler, rt.selfMiddlewares[messageID], rt.messageIDAnchors[messageID], ok
+}
+
+// match url to a registered pattern, returns handlers of the pattern and params of url.
+func (rt *routeTable) matchURL(url string) (string, []func(c *Context), []urlParam, bool) {
+	urlPattern, params, ok := rt.tree.match(url)
+	if !ok {
+		return "", nil, nil, false
+	}
+	return urlPattern, rt.urlHandlers[urlPattern], params, true
+}
+
+// Remove handler of messageID, with its self-related middlewares and conditional routes.
+func (tcpx *TcpX) RemoveHandler(messageID int32) error {
+	mux := tcpx.Mux
+	mux.Mutex.Lock()
+	defer mux.Mutex.Unlock()
+	if mux.isReadOnly() {
+		return errorx.NewFromString("mux is only writable when mux.AllowAdd is true")
+	}
+	_, ok := mux.Handlers[messageID]
+	if !ok && len(mux.messageIDCandidates[messageID]) == 0 {
+		return newFrameError(ErrRouteNotFound, nil, "messageID %d", messageID)
+	}
+	delete(mux.Handlers, messageID)
+	delete(mux.messageIDCandidates, messageID)
+	delete(mux.MessageIDSelfMiddleware, messageID)
+	delete(mux.MessageIDAnchorMap, messageID)
+	delete(mux.messageIDRouteInfo, messageID)
+	mux.publish()
+	return nil
+}
+
+// Replace handler and self-related middlewares of messageID, the last of handlers is the handler, the same as AddHandler.
+// Anchor middlewares working for the old handler keep working for the new one. Conditional routes are kept.
+// Reserved messageIDs are rejected, use srv.RewriteHeartBeatHandler for heartbeat.
+func (tcpx *TcpX) ReplaceHandler(messageID int32, handlers ...func(c *Context)) error {
+	if len(handlers) <= 0 {
+		panic(errorx.NewFromStringf("handlers should more than 1 but got %d", len(handlers)))
+	}
+	if IsReservedMessageID(messageID) {
+		return reservedMessageIDError(messageID)
+	}
+	if matchers, _ := splitMatchers(handlers); len(matchers) > 0 {
+		return errorx.NewFromStringf("messageID %d: ReplaceHandler replaces the unconditioned handler, matchers are not supported", messageID)
+	}
+	mux := tcpx.Mux
+	mux.Mutex.Lock()
+	defer mux.Mutex.Unlock()
+	if mux.isReadOnly() {
+		return errorx.NewFromString("mux is only writable when mux.AllowAdd is true")
+	}
+	if _, ok := mux.Handlers[messageID]; !ok {
+		return newFrameError(ErrRouteNotFound, nil, "messageID %d", messageID)
+	}
+	mux.Handlers[messageID] = handlers[len(handlers)-1]
+	delete(mux.MessageIDSelfMiddleware, messageID)
+	if len(handlers) > 1 {
+		mux.MessageIDSelfMiddleware[messageID] = copyHandlers(handlers[:len(handlers)-1])
+	}
+	if mux.messageIDRouteInfo == nil {
+		mux.messageIDRouteInfo = make(map[int32]Route, 0)
+	}
+	mux.messageIDRouteInfo[messageID] = Route{
+		MessageId: int(messageID),
+		Whereis:   []string{callerLocation()},
+	}
+	mux.publish()
+	return nil
+}
+
+// Remove an url-pattern route.
+func (tcpx *TcpX) RemoveRoute(urlPattern string) error {
+	mux := tcpx.Mux
+	mux.Mutex.Lock()
+	defer mux.Mutex.Unlock()
+	if mux.isReadOnly() {
+		return errorx.NewFromString("mux is only writable when mux.AllowAdd is true")
+	}
+	if _, ok := mux.urlMux.urlPatternMux[urlPattern]; !ok {
+		return newFrameError(ErrRouteNotFound, nil, "urlPattern %s", urlPattern)
+	}
+	mux.urlMux.remove(urlPattern)
+	delete(mux.urlMux.URLAnchorMap, urlPattern)
+	mux.publish()
+	return nil
+}
+
+// Disable an anchor middleware added by srv.Use(middlewareKey, middleware), or a conditional one by srv.UseWhen,
+// it stops working for all routes until enabled.
+func (tcpx *TcpX) DisableMiddleware(middlewareKey string) error {
+	return tcpx.Mux.setMiddlewareDisabled(middlewareKey, true)
+}
+
+// Enable an anchor middleware disabled by DisableMiddleware.
+func (tcpx *TcpX) EnableMiddleware(middlewareKey string) error {
+	return tcpx.Mux.setMiddlewareDisabled(middlewareKey, false)
+}
+
+func (mux *Mux) setMiddlewareDisabled(middlewareKey string, disabled bool) error {
+	mux.Mutex.Lock()
+	defer mux.Mutex.Unlock()
+	if _, ok := mux.MiddlewareAnchorMap[middlewareKey]; !ok && !mux.hasWhenMiddleware(middlewareKey) {
+		return errorx.NewFromStringf("middlewareKey '%s' not found in mux.MiddlewareAnchorMap nor added by UseWhen", middlewareKey)
+	}
+	if mux.disabledMiddlewares == nil {
+		mux.disabledMiddlewares = make(map[string]bool)
+	}
+	if disabled {
+		mux.disabledMiddlewares[middlewareKey] = true
+	} else {
+		delete(mux.disabledMiddlewares, middlewareKey)
+	}
+	mux.publish()
+	return nil
+}
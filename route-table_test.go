@@ -0,0 +1,144 @@
+package tcpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTcpX_RuntimeRoutes(t *testing.T) {
+	srv := NewTcpX(JsonMarshaller{})
+	srv.Use("mark", func(c *Context) {
+		c.SetCtxPerRequest("marked", true)
+	})
+	var reply = func(version string) func(c *Context) {
+		return func(c *Context) {
+			marked, _ := c.GetCtxPerRequest("marked")
+			c.Reply(1, fmt.Sprintf("%s %v", version, marked == true))
+		}
+	}
+	srv.AddHandler(1, reply("v1"))
+	srv.AddHandler(2, reply("v1"))
+	srv.Any("/feature/", func(c *Context) {
+		c.JSONURLPattern("on")
+	})
+	go srv.ListenAndServe("tcp", ":7025")
+	time.Sleep(500 * time.Millisecond)
+
+	client, e := Dial("tcp", "localhost:7025", JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+	client.Timeout = 3 * time.Second
+
+	var call = func(messageID int32) (string, error) {
+		var got string
+		e := client.Call(context.Background(), messageID, nil, &got)
+		return got, e
+	}
+
+	// change routes while requests are being handled
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				call(1)
+			}
+		}()
+	}
+	for j := 0; j < 50; j++ {
+		srv.DisableMiddleware("mark")
+		srv.ReplaceHandler(1, reply(fmt.Sprintf("v%d", j)))
+		srv.EnableMiddleware("mark")
+		srv.Any(fmt.Sprintf("/runtime/%d/", j), func(c *Context) {})
+	}
+	wg.Wait()
+
+	if e := srv.ReplaceHandler(1, reply("v2")); e != nil {
+		t.Fatal(e.Error())
+	}
+	if got, e := call(1); e != nil || got != "v2 true" {
+		fmt.Println(fmt.Sprintf("replaced handler want 'v2 true' but got '%s', %v", got, e))
+		t.Fail()
+	}
+
+	srv.DisableMiddleware("mark")
+	if got, e := call(1); e != nil || got != "v2 false" {
+		fmt.Println(fmt.Sprintf("disabled middleware want 'v2 false' but got '%s', %v", got, e))
+		t.Fail()
+	}
+	srv.EnableMiddleware("mark")
+	if got, e := call(1); e != nil || got != "v2 true" {
+		fmt.Println(fmt.Sprintf("enabled middleware want 'v2 true' but got '%s', %v", got, e))
+		t.Fail()
+	}
+
+	if e := srv.RemoveHandler(2); e != nil {
+		t.Fatal(e.Error())
+	}
+	if _, e := call(2); !errors.Is(e, ErrUnknownRoute) {
+		fmt.Println(fmt.Sprintf("removed handler want not-found but got %v", e))
+		t.Fail()
+	}
+	if e := srv.RemoveHandler(2); !errors.Is(e, ErrRouteNotFound) {
+		fmt.Println(fmt.Sprintf("removing again want ErrRouteNotFound but got %v", e))
+		t.Fail()
+	}
+	srv.AddHandler(2, reply("v3"))
+	if got, e := call(2); e != nil || got != "v3 true" {
+		fmt.Println(fmt.Sprintf("handler added again want 'v3 true' but got '%s', %v", got, e))
+		t.Fail()
+	}
+
+	if e := srv.RemoveRoute("/feature/"); e != nil {
+		t.Fatal(e.Error())
+	}
+	if e := client.CallURLPattern(context.Background(), "/feature/", nil, nil); !errors.Is(e, ErrUnknownRoute) {
+		fmt.Println(fmt.Sprintf("removed route want not-found but got %v", e))
+		t.Fail()
+	}
+	if e := srv.DisableMiddleware("none"); e == nil {
+		fmt.Println("disabling unknown middleware should fail")
+		t.Fail()
+	}
+}
+
+func TestMux_LazyPublish(t *testing.T) {
+	srv := NewTcpX(JsonMarshaller{})
+	var builds = func() *routeTable {
+		rt, _ := srv.Mux.table.Load().(*routeTable)
+		return rt
+	}
+	for i := 0; i < 100; i++ {
+		srv.AddHandler(int32(i), func(c *Context) {})
+		srv.Any(fmt.Sprintf("/lazy/%d/", i), func(c *Context) {})
+	}
+	if builds() != nil {
+		fmt.Println("registering routes should only mark routes stale")
+		t.Fail()
+	}
+	rt := srv.Mux.routes()
+	if len(rt.handlers) != 100 || len(rt.urlHandlers) != 100 {
+		fmt.Println(fmt.Sprintf("routes want 100 messageIDs and 100 url-patterns but got %d, %d", len(rt.handlers), len(rt.urlHandlers)))
+		t.Fail()
+	}
+	if srv.Mux.routes() != rt {
+		fmt.Println("routes should not be rebuilt without changes")
+		t.Fail()
+	}
+	srv.RemoveHandler(1)
+	if builds() != nil {
+		fmt.Println("a change should mark routes stale")
+		t.Fail()
+	}
+	if _, ok := srv.Mux.routes().handlers[1]; ok {
+		fmt.Println("routes rebuilt should not have removed messageID 1")
+		t.Fail()
+	}
+}
@@ -1,6 +1,11 @@
 package tcpx
 
-import "strings"
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
 
 type Route struct {
 	URLPattern string
@@ -17,3 +22,38 @@ func (r *Route) Merge(r2 Route) Route{
 func (r Route) Location() string {
 	return strings.Join(r.Whereis, "\n")
 }
+
+// location of the first caller outside tcpx, like '/app/main.go:20'.
+// Routes are registered through srv.AddHandler, group.Any, tcpx.Handle... so caller depth is not fixed.
+// Tests of tcpx count as outside.
+func callerLocation() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var first string
+	for {
+		frame, more := frames.Next()
+		location := fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		if first == "" {
+			first = location
+		}
+		if !strings.HasPrefix(frame.Function, "github.com/fwhezfwhez/tcpx.") || strings.HasSuffix(frame.File, "_test.go") {
+			return location
+		}
+		if !more {
+			return first
+		}
+	}
+}
+
+// function name of f, like 'main.sayHello', 'main.main.func1' for anonymous functions.
+func funcName(f func(c *Context)) string {
+	if f == nil {
+		return ""
+	}
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return ""
+	}
+	return fn.Name()
+}
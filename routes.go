@@ -0,0 +1,212 @@
+package tcpx
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// ## introduction:
+// srv.Routes() lists all routes with their resolved middleware chains, in order of execution:
+/*
+   for _, r := range srv.Routes() {
+       fmt.Println(r.MessageID, r.URLPattern, r.Handler, r.Whereis)
+       for _, node := range r.Chain {
+           fmt.Println(node.Kind, node.Key, node.Name)
+       }
+   }
+*/
+// In debug mode, ListenAndServe prints them as a table on startup:
+/*
+   ROUTE              HANDLER          CHAIN                                            WHEREIS
+   messageID 1        main.sayHello    global main.log -> anchor[auth] main.auth -> ... /app/main.go:20
+   urlPattern /chat/  main.chat        global main.log -> main.chat                     /app/main.go:25
+*/
+// Chains are what the latest published routes run, disabled anchor middlewares are not listed.
+// When srv.OnMessage is set, frames don't go through routes, and the list does not apply.
+
+// kinds of nodes of a chain
+const (
+	CHAIN_GLOBAL  = "global"
+	CHAIN_ANCHOR  = "anchor"
+	CHAIN_WHEN    = "when"
+	CHAIN_SELF    = "self"
+	CHAIN_HANDLER = "handler"
+)
+
+// ChainNode is a handler of a route's chain.
+type ChainNode struct {
+	// CHAIN_GLOBAL, CHAIN_ANCHOR, CHAIN_WHEN, CHAIN_SELF, CHAIN_HANDLER
+	Kind string
+	// middlewareKey of anchor and conditional middleware, empty for other kinds
+	Key string
+	// predicate of conditional middleware
+	Predicate string
+	// function name, like 'main.sayHello'
+	Name string
+}
+
+// RouteInfo describes a route of messageID or url-pattern.
+type RouteInfo struct {
+	// messageID of route, 0 for url-pattern routes
+	MessageID int32
+	// url-pattern of route, empty for messageID routes
+	URLPattern string
+
+	// descriptions of matchers of a conditional route, empty for unconditioned routes
+	Conditions []string
+
+	// function name of the handler
+	Handler string
+	// where the route is registered, like '/app/main.go:20'
+	Whereis []string
+
+	// global, anchor, conditional, self-related middlewares and the handler, in order of execution
+	Chain []ChainNode
+}
+
+// Routes of messageID in ascending order, and then routes of url-pattern in alphabet order.
+// Conditional routes of a messageID are listed before its unconditioned route, in order of being tried.
+func (tcpx *TcpX) Routes() []RouteInfo {
+	if tcpx.Mux == nil {
+		return nil
+	}
+	mux := tcpx.Mux
+	// route infos are read under the same lock, so they agree with rt
+	mux.Mutex.Lock()
+	defer mux.Mutex.Unlock()
+	rt := mux.routesLocked()
+
+	var globals = make([]ChainNode, 0, len(rt.globals))
+	for _, v := range rt.globals {
+		globals = append(globals, ChainNode{Kind: CHAIN_GLOBAL, Name: funcName(v)})
+	}
+	var anchors = func(anchorIndex int) []ChainNode {
+		var nodes []ChainNode
+		for i := range rt.anchors {
+			if rt.anchors[i].Contains(anchorIndex) {
+				nodes = append(nodes, ChainNode{Kind: CHAIN_ANCHOR, Key: rt.anchors[i].MiddlewareKey, Name: funcName(rt.anchors[i].Middleware)})
+			}
+		}
+		return nodes
+	}
+	var whens = func(wms []whenMiddleware) []ChainNode {
+		var nodes []ChainNode
+		for _, v := range wms {
+			nodes = append(nodes, ChainNode{Kind: CHAIN_WHEN, Key: v.key, Predicate: v.predicate.String(), Name: funcName(v.middleware)})
+		}
+		return nodes
+	}
+
+	var messageIDs = make([]int32, 0, len(rt.handlers))
+	for k := range rt.handlers {
+		messageIDs = append(messageIDs, k)
+	}
+	for k := range rt.messageIDCandidates {
+		if _, ok := rt.handlers[k]; !ok {
+			messageIDs = append(messageIDs, k)
+		}
+	}
+	sort.Slice(messageIDs, func(i, j int) bool { return messageIDs[i] < messageIDs[j] })
+
+	var urlPatterns = make([]string, 0, len(rt.urlHandlers))
+	for k := range rt.urlHandlers {
+		urlPatterns = append(urlPatterns, k)
+	}
+	sort.Strings(urlPatterns)
+
+	var routes = make([]RouteInfo, 0, len(messageIDs)+len(urlPatterns))
+	var messageIDRoute = func(messageID int32, handler func(c *Context), selfMiddlewares []func(c *Context), anchorIndex int) RouteInfo {
+		info := RouteInfo{
+			MessageID: messageID,
+			Handler:   funcName(handler),
+		}
+		// heartbeat and auth skip middlewares, see handleMessageIDHandlers
+		skip := (messageID == tcpx.HeartBeatMessageID && !tcpx.ThroughMiddleware) ||
+			(messageID == tcpx.AuthMessageID && !tcpx.AuthThroughMiddleware)
+		if !skip {
+			info.Chain = append(info.Chain, globals...)
+			info.Chain = append(info.Chain, anchors(anchorIndex)...)
+			info.Chain = append(info.Chain, whens(rt.messageIDWhens[messageID])...)
+			for _, v := range selfMiddlewares {
+				info.Chain = append(info.Chain, ChainNode{Kind: CHAIN_SELF, Name: funcName(v)})
+			}
+		}
+		info.Chain = append(info.Chain, ChainNode{Kind: CHAIN_HANDLER, Name: info.Handler})
+		return info
+	}
+	for _, messageID := range messageIDs {
+		// conditional routes go first, in order of being tried
+		for _, candidate := range rt.messageIDCandidates[messageID] {
+			info := messageIDRoute(messageID, candidate.handler, candidate.selfMiddlewares, candidate.anchorIndex)
+			info.Conditions = candidate.conditions()
+			info.Whereis = []string{candidate.whereis}
+			routes = append(routes, info)
+		}
+		if handler, ok := rt.handlers[messageID]; ok {
+			info := messageIDRoute(messageID, handler, rt.selfMiddlewares[messageID], rt.messageIDAnchors[messageID])
+			info.Whereis = append([]string(nil), mux.messageIDRouteInfo[messageID].Whereis...)
+			routes = append(routes, info)
+		}
+	}
+
+	for _, urlPattern := range urlPatterns {
+		handlers := rt.urlHandlers[urlPattern]
+		info := RouteInfo{
+			URLPattern: urlPattern,
+			Whereis:    append([]string(nil), mux.urlMux.urlRouteInfo[urlPattern].Whereis...),
+		}
+		info.Chain = append(info.Chain, globals...)
+		info.Chain = append(info.Chain, anchors(rt.urlAnchors[urlPattern])...)
+		info.Chain = append(info.Chain, whens(rt.urlWhens[urlPattern])...)
+		// handlers before the last work as self-related middlewares
+		for i, v := range handlers {
+			if i == len(handlers)-1 {
+				info.Handler = funcName(v)
+				info.Chain = append(info.Chain, ChainNode{Kind: CHAIN_HANDLER, Name: info.Handler})
+				break
+			}
+			info.Chain = append(info.Chain, ChainNode{Kind: CHAIN_SELF, Name: funcName(v)})
+		}
+		routes = append(routes, info)
+	}
+	return routes
+}
+
+// Print routes as a table into w.
+func (tcpx *TcpX) PrintRoutes(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROUTE\tHANDLER\tCHAIN\tWHEREIS")
+	for _, r := range tcpx.Routes() {
+		route := fmt.Sprintf("messageID %d", r.MessageID)
+		if r.URLPattern != "" {
+			route = fmt.Sprintf("urlPattern %s", r.URLPattern)
+		}
+		if len(r.Conditions) > 0 {
+			route += fmt.Sprintf(" when %s", strings.Join(r.Conditions, ", "))
+		}
+		var chain = make([]string, 0, len(r.Chain))
+		for _, node := range r.Chain {
+			switch node.Kind {
+			case CHAIN_HANDLER:
+				chain = append(chain, shortFuncName(node.Name))
+			case CHAIN_ANCHOR, CHAIN_WHEN:
+				chain = append(chain, fmt.Sprintf("%s[%s] %s", node.Kind, node.Key, shortFuncName(node.Name)))
+			default:
+				chain = append(chain, fmt.Sprintf("%s %s", node.Kind, shortFuncName(node.Name)))
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", route, shortFuncName(r.Handler), strings.Join(chain, " -> "), strings.Join(r.Whereis, ", "))
+	}
+	tw.Flush()
+}
+
+// 'github.com/fwhezfwhez/tcpx.NotFound' -> 'tcpx.NotFound'
+func shortFuncName(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
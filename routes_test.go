@@ -0,0 +1,76 @@
+package tcpx
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func routesTestAuth(c *Context)    {}
+func routesTestLog(c *Context)     {}
+func routesTestHandler(c *Context) {}
+
+func TestTcpX_Routes(t *testing.T) {
+	srv := NewTcpX(JsonMarshaller{})
+	srv.UseGlobal(routesTestLog)
+	srv.Use("auth", routesTestAuth)
+	srv.AddHandler(2, routesTestLog, routesTestHandler)
+	srv.UnUse("auth")
+	srv.AddHandler(1, routesTestHandler)
+	srv.Group("/chat").Any("/send/", routesTestHandler)
+
+	routes := srv.Routes()
+	if len(routes) != 3 {
+		t.Fatal(fmt.Sprintf("want 3 routes but got %d", len(routes)))
+	}
+
+	var chainOf = func(r RouteInfo) string {
+		var nodes []string
+		for _, v := range r.Chain {
+			nodes = append(nodes, v.Kind+":"+v.Key+":"+shortFuncName(v.Name))
+		}
+		return strings.Join(nodes, ",")
+	}
+	var cases = []struct {
+		messageID  int32
+		urlPattern string
+		chain      string
+	}{
+		{1, "", "global::tcpx.routesTestLog,handler::tcpx.routesTestHandler"},
+		{2, "", "global::tcpx.routesTestLog,anchor:auth:tcpx.routesTestAuth,self::tcpx.routesTestLog,handler::tcpx.routesTestHandler"},
+		{0, "/chat/send/", "global::tcpx.routesTestLog,handler::tcpx.routesTestHandler"},
+	}
+	for i, c := range cases {
+		r := routes[i]
+		if r.MessageID != c.messageID || r.URLPattern != c.urlPattern {
+			fmt.Println(fmt.Sprintf("route %d want %d '%s' but got %d '%s'", i, c.messageID, c.urlPattern, r.MessageID, r.URLPattern))
+			t.Fail()
+		}
+		if got := chainOf(r); got != c.chain {
+			fmt.Println(fmt.Sprintf("route %d want chain '%s' but got '%s'", i, c.chain, got))
+			t.Fail()
+		}
+		if r.Handler != "github.com/fwhezfwhez/tcpx.routesTestHandler" {
+			fmt.Println(fmt.Sprintf("route %d want handler routesTestHandler but got '%s'", i, r.Handler))
+			t.Fail()
+		}
+		if len(r.Whereis) != 1 || !strings.Contains(r.Whereis[0], "routes_test.go:") {
+			fmt.Println(fmt.Sprintf("route %d want registered in routes_test.go but got %v", i, r.Whereis))
+			t.Fail()
+		}
+	}
+
+	srv.DisableMiddleware("auth")
+	if got := chainOf(srv.Routes()[1]); strings.Contains(got, "anchor") {
+		fmt.Println(fmt.Sprintf("disabled middleware should not be listed but got '%s'", got))
+		t.Fail()
+	}
+
+	var buf bytes.Buffer
+	srv.PrintRoutes(&buf)
+	if !strings.Contains(buf.String(), "urlPattern /chat/send/") || !strings.Contains(buf.String(), "tcpx.routesTestHandler") {
+		fmt.Println(buf.String())
+		t.Fail()
+	}
+}
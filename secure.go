@@ -0,0 +1,285 @@
+package tcpx
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+// ## introduction:
+// Secure session is an application-layer encryption for clients that can not run full TLS.
+// When server calls `srv.WithSecureSession(true, psk)`, each accepted tcp connection must finish an
+// X25519 handshake before its OnConnect runs. Client side does it like:
+/*
+   conn, _ := net.Dial("tcp", "localhost:8080")
+   conn, e = tcpx.SecureClient(conn, psk)
+   // from now on, conn seals and opens every byte transparently
+   conn.Write(buf)
+*/
+// After handshake, every frame header and body written to the connection is sealed by AES-256-GCM.
+// Each direction has its own key and a strictly increasing sequence number as nonce, so replayed,
+// reordered or tampered records are refused and the connection is closed.
+//
+// handshake frame:
+// client -> server: messageID DEFAULT_HANDSHAKE_MESSAGEID, body [32]byte client public key
+// server -> client: messageID DEFAULT_HANDSHAKE_MESSAGEID, body [32]byte server public key
+//
+// record after handshake:
+// [4]byte -- length             fixed_size,binary big endian encode, length of sequence and sealed
+// [8]byte -- sequence           fixed_size,binary big endian encode
+// []byte -- sealed              aes-256-gcm sealed plain bytes
+
+const (
+	DEFAULT_HANDSHAKE_MESSAGEID = 1394
+
+	// max plain bytes a record contains, bigger writes will be split into several records
+	secureRecordMaxPlain = 64 * 1024
+	secureSequenceSize   = 8
+	secureHandshakeInfo  = "tcpx secure session v1"
+)
+
+// returned by SecureConn.Read when a record doesn't carry the expected sequence
+var ErrSecureRecordReplayed = errors.New("secure record sequence is not the expected one, replayed or reordered")
+
+// SecureConn wraps a net.Conn. Writes are sealed into records and reads are opened from records.
+// It's concurrently safe to write in multiple goroutines, each Write call will be written as complete records.
+type SecureConn struct {
+	net.Conn
+
+	sealer cipher.AEAD
+	opener cipher.AEAD
+
+	wLock   *sync.Mutex
+	sendSeq uint64
+
+	rLock   *sync.Mutex
+	recvSeq uint64
+	plain   []byte
+}
+
+// Run server side handshake on an accepted connection.
+// preSharedKey is optional, when not empty, client must hold the same key or the handshake can't produce same session keys.
+// timeout limits the whole handshake, zero means no limit.
+func SecureServer(conn net.Conn, preSharedKey []byte, timeout time.Duration) (*SecureConn, error) {
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	priv, e := ecdh.X25519().GenerateKey(rand.Reader)
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+
+	buf, e := FirstBlockOfLimitMaxByte(conn, 1024)
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+	clientPub, e := handshakePublicKeyOf(buf)
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+
+	hello, e := PackWithMarshallerAndBody(Message{MessageID: DEFAULT_HANDSHAKE_MESSAGEID}, priv.PublicKey().Bytes())
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+	if e = WriteConn(hello, conn); e != nil {
+		return nil, errorx.Wrap(e)
+	}
+
+	shared, e := priv.ECDH(clientPub)
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+	c2s, s2c := deriveSessionKeys(shared, preSharedKey, clientPub.Bytes(), priv.PublicKey().Bytes())
+	return newSecureConn(conn, s2c, c2s)
+}
+
+// Run client side handshake on a dialed connection.
+// The returned conn should replace the raw one, all later reads and writes should go through it.
+func SecureClient(conn net.Conn, preSharedKey []byte) (*SecureConn, error) {
+	priv, e := ecdh.X25519().GenerateKey(rand.Reader)
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+
+	hello, e := PackWithMarshallerAndBody(Message{MessageID: DEFAULT_HANDSHAKE_MESSAGEID}, priv.PublicKey().Bytes())
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+	if e = WriteConn(hello, conn); e != nil {
+		return nil, errorx.Wrap(e)
+	}
+
+	buf, e := FirstBlockOfLimitMaxByte(conn, 1024)
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+	serverPub, e := handshakePublicKeyOf(buf)
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+
+	shared, e := priv.ECDH(serverPub)
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+	c2s, s2c := deriveSessionKeys(shared, preSharedKey, priv.PublicKey().Bytes(), serverPub.Bytes())
+	return newSecureConn(conn, c2s, s2c)
+}
+
+func handshakePublicKeyOf(block []byte) (*ecdh.PublicKey, error) {
+	messageID, e := MessageIDOf(block)
+	if e != nil {
+		return nil, e
+	}
+	if messageID != DEFAULT_HANDSHAKE_MESSAGEID {
+		return nil, fmt.Errorf("handshake requires messageID %d but got %d", DEFAULT_HANDSHAKE_MESSAGEID, messageID)
+	}
+	body, e := BodyBytesOf(block)
+	if e != nil {
+		return nil, e
+	}
+	return ecdh.X25519().NewPublicKey(body)
+}
+
+// derive client-to-server and server-to-client keys by hkdf-sha256.
+// preSharedKey is used as salt, public keys of both sides are bound into info.
+func deriveSessionKeys(shared, preSharedKey, clientPub, serverPub []byte) ([]byte, []byte) {
+	mac := hmac.New(sha256.New, preSharedKey)
+	mac.Write(shared)
+	prk := mac.Sum(nil)
+
+	info := make([]byte, 0, len(secureHandshakeInfo)+len(clientPub)+len(serverPub))
+	info = append(info, secureHandshakeInfo...)
+	info = append(info, clientPub...)
+	info = append(info, serverPub...)
+
+	var okm, t []byte
+	for i := byte(1); len(okm) < 64; i++ {
+		mac = hmac.New(sha256.New, prk)
+		mac.Write(t)
+		mac.Write(info)
+		mac.Write([]byte{i})
+		t = mac.Sum(nil)
+		okm = append(okm, t...)
+	}
+	return okm[:32], okm[32:64]
+}
+
+func newSecureConn(conn net.Conn, sendKey, recvKey []byte) (*SecureConn, error) {
+	sealer, e := newGCM(sendKey)
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+	opener, e := newGCM(recvKey)
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+	return &SecureConn{
+		Conn:   conn,
+		sealer: sealer,
+		opener: opener,
+		wLock:  &sync.Mutex{},
+		rLock:  &sync.Mutex{},
+	}, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, e := aes.NewCipher(key)
+	if e != nil {
+		return nil, e
+	}
+	return cipher.NewGCM(block)
+}
+
+func secureNonce(aead cipher.AEAD, seq uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-secureSequenceSize:], seq)
+	return nonce
+}
+
+// Write seals buf into records. Records of one Write are never interleaved with other Writes.
+func (sc *SecureConn) Write(buf []byte) (int, error) {
+	sc.wLock.Lock()
+	defer sc.wLock.Unlock()
+
+	var sum int
+	for len(buf) > 0 {
+		plain := buf
+		if len(plain) > secureRecordMaxPlain {
+			plain = plain[:secureRecordMaxPlain]
+		}
+
+		record := make([]byte, 4+secureSequenceSize, 4+secureSequenceSize+len(plain)+sc.sealer.Overhead())
+		binary.BigEndian.PutUint64(record[4:], sc.sendSeq)
+		record = sc.sealer.Seal(record, secureNonce(sc.sealer, sc.sendSeq), plain, record[4:4+secureSequenceSize])
+		binary.BigEndian.PutUint32(record[0:4], uint32(len(record)-4))
+
+		if e := WriteConn(record, sc.Conn); e != nil {
+			return sum, e
+		}
+		sc.sendSeq++
+		sum += len(plain)
+		buf = buf[len(plain):]
+	}
+	return sum, nil
+}
+
+// Read opens records and returns plain bytes. A record failing authentication or arriving out of sequence returns error.
+func (sc *SecureConn) Read(buf []byte) (int, error) {
+	sc.rLock.Lock()
+	defer sc.rLock.Unlock()
+
+	for len(sc.plain) == 0 {
+		if e := sc.readRecord(); e != nil {
+			return 0, e
+		}
+	}
+	n := copy(buf, sc.plain)
+	sc.plain = sc.plain[n:]
+	return n, nil
+}
+
+func (sc *SecureConn) readRecord() error {
+	var info = make([]byte, 4)
+	if e := readUntil(sc.Conn, info); e != nil {
+		return e
+	}
+	length := binary.BigEndian.Uint32(info)
+	if length < uint32(secureSequenceSize+sc.opener.Overhead()) || length > uint32(secureSequenceSize+secureRecordMaxPlain+sc.opener.Overhead()) {
+		return errorx.NewFromStringf("secure record length %d out of range", length)
+	}
+
+	var record = make([]byte, length)
+	if e := readUntil(sc.Conn, record); e != nil {
+		return e
+	}
+	seq := binary.BigEndian.Uint64(record[:secureSequenceSize])
+	if seq != sc.recvSeq {
+		return ErrSecureRecordReplayed
+	}
+
+	plain, e := sc.opener.Open(record[secureSequenceSize:secureSequenceSize], secureNonce(sc.opener, seq), record[secureSequenceSize:], record[:secureSequenceSize])
+	if e != nil {
+		return errorx.Wrap(e)
+	}
+	sc.recvSeq++
+	sc.plain = plain
+	return nil
+}
+
+// make sure SecureConn can be used anywhere a net.Conn is required
+var _ net.Conn = &SecureConn{}
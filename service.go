@@ -0,0 +1,244 @@
+package tcpx
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+// ## introduction:
+// RegisterService exposes exported methods of a service as routes, like net/rpc:
+/*
+   type UserService struct {
+       // optional messageIDs of methods
+       _ struct{} `tcpx:"Login=1001"`
+   }
+
+   func (s *UserService) Login(c *tcpx.Context, req *LoginReq) (*LoginResp, error) {...}
+   func (s *UserService) Logout(c *tcpx.Context, req *LogoutReq) (*LogoutResp, error) {...}
+   // messageID of Logout, by method-name convention '<Method>MessageID'
+   func (s *UserService) LogoutMessageID() int32 { return 1002 }
+
+   srv.RegisterService(&UserService{})
+*/
+// Methods of signature 'func(*tcpx.Context, *Req) (*Resp, error)' are registered as url-pattern '/<Service>/<Method>',
+// like '/UserService/Login', and also as messageID when it's set by tag or method-name convention, 0 is a messageID as well.
+// Other methods are skipped. Requests are bound and responses are replied the same as tcpx.Handle.
+// Pass a pointer to the service, so that methods of pointer receiver are found, the same as net/rpc.
+// Errors are returned when the service is malformed, or its routes conflict with registered ones or each other,
+// and then none of its routes is registered. Conflicts are ErrRouteConflict, errors.Is(e, tcpx.ErrRouteConflict) tells.
+
+var (
+	contextPtrType = reflect.TypeOf((*Context)(nil))
+	errorType      = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// a method registered by RegisterService
+type serviceMethod struct {
+	name   string
+	method reflect.Method
+	// set by tag or method-name convention, 0 is a valid messageID
+	messageID    int32
+	hasMessageID bool
+}
+
+// RegisterService registers methods of service, named by type name of service.
+func (tcpx *TcpX) RegisterService(service interface{}, mids ...func(c *Context)) error {
+	if service == nil {
+		return errorx.NewFromString("tcpx.RegisterService requires service not nil")
+	}
+	name := indirectType(reflect.TypeOf(service)).Name()
+	if name == "" {
+		return errorx.NewFromStringf("tcpx.RegisterService requires a named type but got %s, use RegisterServiceName", reflect.TypeOf(service))
+	}
+	return tcpx.RegisterServiceName(name, service, mids...)
+}
+
+// RegisterServiceName registers methods of service as '/<name>/<Method>'.
+// mids are self-related middlewares of all methods.
+func (tcpx *TcpX) RegisterServiceName(name string, service interface{}, mids ...func(c *Context)) error {
+	if service == nil {
+		return errorx.NewFromString("tcpx.RegisterServiceName requires service not nil")
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return errorx.NewFromStringf("service name '%s' should be non-empty and without '/'", name)
+	}
+	rcvr := reflect.ValueOf(service)
+	// not wrapped, so that errors.Is(e, ErrReservedMessageID) works
+	methods, e := serviceMethods(rcvr)
+	if e != nil {
+		return e
+	}
+	if len(methods) == 0 {
+		return errorx.NewFromStringf("service %s has no exported method of signature func(*tcpx.Context, *Req) (*Resp, error)", name)
+	}
+
+	if tcpx.Mux == nil {
+		tcpx.Mux = NewMux()
+	}
+	// not wrapped, so that errors.Is(e, ErrRouteConflict) works
+	if e := tcpx.Mux.checkServiceRoutes(name, methods); e != nil {
+		return e
+	}
+	for _, m := range methods {
+		if m.hasMessageID {
+			tcpx.AddHandler(m.messageID, append(copyHandlers(mids), methodHandler(rcvr, m.method, messageIDReply(m.messageID)))...)
+		}
+		tcpx.Any(serviceURLPattern(name, m.name), append(copyHandlers(mids), methodHandler(rcvr, m.method, urlPatternReply))...)
+	}
+	return nil
+}
+
+// '/<service>/<method>'
+func serviceURLPattern(service string, method string) string {
+	return fmt.Sprintf("/%s/%s", service, method)
+}
+
+// check routes of methods before registering any of them, so that a conflict leaves routes unchanged
+func (mux *Mux) checkServiceRoutes(name string, methods []serviceMethod) error {
+	mux.Mutex.RLock()
+	defer mux.Mutex.RUnlock()
+	if mux.isReadOnly() {
+		return errorx.NewFromString("mux is only writable when mux.AllowAdd is true")
+	}
+	var messageIDs = make(map[int32]string, len(methods))
+	for _, m := range methods {
+		if m.hasMessageID {
+			if other, ok := messageIDs[m.messageID]; ok {
+				return newFrameError(ErrRouteConflict, nil, "methods %s and %s of service %s have the same messageID %d", other, m.name, name, m.messageID)
+			}
+			messageIDs[m.messageID] = m.name
+			if _, ok := mux.Handlers[m.messageID]; ok {
+				return newFrameError(ErrRouteConflict, nil, "method %s of service %s conflicts on the same messageID %d, the existed route-info is at:\n%s", m.name, name, m.messageID, mux.messageIDRouteInfo[m.messageID].Location())
+			}
+		}
+		urlPattern := serviceURLPattern(name, m.name)
+		if _, ok := mux.urlMux.urlPatternMux[urlPattern]; ok {
+			return newFrameError(ErrRouteConflict, nil, "method %s of service %s conflicts on the same url-pattern %s, the existed route-info is at:\n%s", m.name, name, urlPattern, mux.urlMux.urlRouteInfo[urlPattern].Location())
+		}
+	}
+	return nil
+}
+
+// exported methods of signature func(*Context, *Req) (*Resp, error), with their messageIDs
+func serviceMethods(rcvr reflect.Value) ([]serviceMethod, error) {
+	typ := rcvr.Type()
+	tags, e := serviceTagMessageIDs(indirectType(typ))
+	if e != nil {
+		return nil, errorx.Wrap(e)
+	}
+
+	var methods []serviceMethod
+	var names = make(map[string]bool)
+	for i := 0; i < typ.NumMethod(); i++ {
+		method := typ.Method(i)
+		if !isServiceMethod(method.Type) {
+			continue
+		}
+		m := serviceMethod{name: method.Name, method: method}
+		m.messageID, m.hasMessageID = tags[method.Name]
+		if messageID, ok := conventionMessageID(rcvr, method.Name); ok {
+			if m.hasMessageID && m.messageID != messageID {
+				return nil, errorx.NewFromStringf("method %s has messageID %d by tag but %d by %sMessageID()", method.Name, m.messageID, messageID, method.Name)
+			}
+			m.messageID, m.hasMessageID = messageID, true
+		}
+		if m.hasMessageID && IsReservedMessageID(m.messageID) {
+			return nil, reservedMessageIDError(m.messageID)
+		}
+		names[method.Name] = true
+		methods = append(methods, m)
+	}
+	for k := range tags {
+		if !names[k] {
+			return nil, errorx.NewFromStringf("tag of messageID names '%s', which is not a method of signature func(*tcpx.Context, *Req) (*Resp, error)", k)
+		}
+	}
+	return methods, nil
+}
+
+func indirectType(typ reflect.Type) reflect.Type {
+	if typ.Kind() == reflect.Ptr {
+		return typ.Elem()
+	}
+	return typ
+}
+
+// func(receiver, *Context, *Req) (*Resp, error)
+func isServiceMethod(mtype reflect.Type) bool {
+	if mtype.NumIn() != 3 || mtype.NumOut() != 2 {
+		return false
+	}
+	return mtype.In(1) == contextPtrType &&
+		mtype.In(2).Kind() == reflect.Ptr &&
+		mtype.Out(0).Kind() == reflect.Ptr &&
+		mtype.Out(1) == errorType
+}
+
+// messageIDs of fields tagged like `tcpx:"Login=1001,Logout=1002"`
+func serviceTagMessageIDs(typ reflect.Type) (map[string]int32, error) {
+	var messageIDs = make(map[string]int32)
+	if typ.Kind() != reflect.Struct {
+		return messageIDs, nil
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		tag, ok := typ.Field(i).Tag.Lookup("tcpx")
+		if !ok {
+			continue
+		}
+		for _, pair := range strings.Split(tag, ",") {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return nil, errorx.NewFromStringf("tag '%s' should be in form of 'Method=messageID'", pair)
+			}
+			messageID, e := strconv.ParseInt(strings.TrimSpace(kv[1]), 10, 32)
+			if e != nil {
+				return nil, errorx.NewFromStringf("tag '%s' has a bad messageID", pair)
+			}
+			method := strings.TrimSpace(kv[0])
+			if _, ok := messageIDs[method]; ok {
+				return nil, errorx.NewFromStringf("tag of method '%s' is set twice", method)
+			}
+			messageIDs[method] = int32(messageID)
+		}
+	}
+	return messageIDs, nil
+}
+
+// messageID returned by method '<name>MessageID() int32' of rcvr
+func conventionMessageID(rcvr reflect.Value, name string) (int32, bool) {
+	m := rcvr.MethodByName(name + "MessageID")
+	if !m.IsValid() {
+		return 0, false
+	}
+	if m.Type().NumIn() != 0 || m.Type().NumOut() != 1 || m.Type().Out(0).Kind() != reflect.Int32 {
+		return 0, false
+	}
+	return int32(m.Call(nil)[0].Int()), true
+}
+
+// handler calling method of rcvr, the same as typedHandler
+func methodHandler(rcvr reflect.Value, method reflect.Method, reply func(c *Context, src interface{}) error) func(c *Context) {
+	reqType := method.Type.In(2).Elem()
+	return bindCallReply(func() interface{} {
+		return reflect.New(reqType).Interface()
+	}, func(c *Context, req interface{}) (interface{}, error) {
+		out := method.Func.Call([]reflect.Value{rcvr, reflect.ValueOf(c), reflect.ValueOf(req)})
+		var e error
+		if !out[1].IsNil() {
+			e = out[1].Interface().(error)
+		}
+		// a nil *Resp is replied as empty body, not as a typed nil
+		if out[0].IsNil() {
+			return nil, e
+		}
+		return out[0].Interface(), e
+	}, reply)
+}
@@ -0,0 +1,196 @@
+package tcpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type serviceLoginReq struct {
+	Username string `json:"username"`
+}
+type serviceLoginResp struct {
+	Token string `json:"token"`
+}
+
+type UserService struct {
+	_ struct{} `tcpx:"Login=1001"`
+}
+
+func (s *UserService) Login(c *Context, req *serviceLoginReq) (*serviceLoginResp, error) {
+	if req.Username == "" {
+		return nil, NewStatusError(CLIENT_ERROR, "bad username", "username is empty")
+	}
+	return &serviceLoginResp{Token: "token-" + req.Username}, nil
+}
+
+func (s *UserService) Logout(c *Context, req *serviceLoginReq) (*serviceLoginResp, error) {
+	return nil, nil
+}
+
+func (s *UserService) LogoutMessageID() int32 {
+	return 1002
+}
+
+// skipped, not of signature func(*Context, *Req) (*Resp, error)
+func (s *UserService) Helper(username string) string {
+	return username
+}
+
+type reservedService struct{}
+
+func (s *reservedService) Ping(c *Context, req *serviceLoginReq) (*serviceLoginResp, error) {
+	return nil, nil
+}
+
+func (s *reservedService) PingMessageID() int32 {
+	return DEFAULT_HEARTBEAT_MESSAGEID
+}
+
+// Logout conflicts with messageID 1002 of UserService, Login with nothing
+type conflictService struct{}
+
+func (s *conflictService) Login(c *Context, req *serviceLoginReq) (*serviceLoginResp, error) {
+	return nil, nil
+}
+
+func (s *conflictService) LoginMessageID() int32 {
+	return 1003
+}
+
+func (s *conflictService) Logout(c *Context, req *serviceLoginReq) (*serviceLoginResp, error) {
+	return nil, nil
+}
+
+func (s *conflictService) LogoutMessageID() int32 {
+	return 1002
+}
+
+type sameMessageIDService struct {
+	_ struct{} `tcpx:"Login=1004,Logout=1004"`
+}
+
+func (s *sameMessageIDService) Login(c *Context, req *serviceLoginReq) (*serviceLoginResp, error) {
+	return nil, nil
+}
+
+func (s *sameMessageIDService) Logout(c *Context, req *serviceLoginReq) (*serviceLoginResp, error) {
+	return nil, nil
+}
+
+// messageID 0 is declared, not unset
+type zeroService struct{}
+
+func (s *zeroService) Ping(c *Context, req *serviceLoginReq) (*serviceLoginResp, error) {
+	return &serviceLoginResp{Token: "zero"}, nil
+}
+
+func (s *zeroService) PingMessageID() int32 {
+	return 0
+}
+
+type zeroTagService struct {
+	_ struct{} `tcpx:"Login=0"`
+}
+
+func (s *zeroTagService) Login(c *Context, req *serviceLoginReq) (*serviceLoginResp, error) {
+	return nil, nil
+}
+
+type badTagService struct {
+	_ struct{} `tcpx:"Missing=1"`
+}
+
+func (s *badTagService) Ping(c *Context, req *serviceLoginReq) (*serviceLoginResp, error) {
+	return nil, nil
+}
+
+func TestTcpX_RegisterService(t *testing.T) {
+	srv := NewTcpX(JsonMarshaller{})
+	if e := srv.RegisterService(&UserService{}); e != nil {
+		t.Fatal(e.Error())
+	}
+	if e := srv.RegisterService(&zeroService{}); e != nil {
+		t.Fatal(e.Error())
+	}
+	go srv.ListenAndServe("tcp", ":7029")
+	time.Sleep(500 * time.Millisecond)
+
+	client, e := Dial("tcp", "localhost:7029", JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+	client.Timeout = 3 * time.Second
+
+	var resp serviceLoginResp
+	if e := client.CallURLPattern(context.Background(), "/UserService/Login", serviceLoginReq{Username: "tcpx"}, &resp); e != nil || resp.Token != "token-tcpx" {
+		fmt.Println(fmt.Sprintf("url-pattern want 'token-tcpx' but got '%s', %v", resp.Token, e))
+		t.Fail()
+	}
+	resp = serviceLoginResp{}
+	if e := client.Call(context.Background(), 1001, serviceLoginReq{Username: "id"}, &resp); e != nil || resp.Token != "token-id" {
+		fmt.Println(fmt.Sprintf("messageID by tag want 'token-id' but got '%s', %v", resp.Token, e))
+		t.Fail()
+	}
+	var se *StatusError
+	if e := client.Call(context.Background(), 1001, serviceLoginReq{}, &resp); !errors.As(e, &se) || se.Code != CLIENT_ERROR {
+		fmt.Println(fmt.Sprintf("status error want CLIENT_ERROR but got %v", e))
+		t.Fail()
+	}
+	if e := client.Call(context.Background(), 1002, serviceLoginReq{}, nil); e != nil {
+		fmt.Println(fmt.Sprintf("messageID by convention want nil but got %v", e))
+		t.Fail()
+	}
+	resp = serviceLoginResp{}
+	if e := client.Call(context.Background(), 0, serviceLoginReq{}, &resp); e != nil || resp.Token != "zero" {
+		fmt.Println(fmt.Sprintf("messageID 0 by convention want 'zero' but got '%s', %v", resp.Token, e))
+		t.Fail()
+	}
+	if e := client.CallURLPattern(context.Background(), "/UserService/Helper", nil, nil); !errors.Is(e, ErrUnknownRoute) {
+		fmt.Println(fmt.Sprintf("non-service method should not be registered but got %v", e))
+		t.Fail()
+	}
+
+	if e := srv.RegisterService(&reservedService{}); !errors.Is(e, ErrReservedMessageID) {
+		fmt.Println(fmt.Sprintf("reserved messageID want ErrReservedMessageID but got %v", e))
+		t.Fail()
+	}
+	if e := srv.RegisterService(&badTagService{}); e == nil {
+		fmt.Println("tag naming no method should fail")
+		t.Fail()
+	}
+	if e := srv.RegisterService(struct{}{}); e == nil {
+		fmt.Println("anonymous service should fail")
+		t.Fail()
+	}
+	// conflicts are returned before any route of the service is registered
+	var routes = len(srv.Routes())
+	if e := srv.RegisterService(&conflictService{}); !errors.Is(e, ErrRouteConflict) {
+		fmt.Println(fmt.Sprintf("conflicting messageID want ErrRouteConflict but got %v", e))
+		t.Fail()
+	}
+	if e := srv.RegisterServiceName("UserService", &conflictService{}); !errors.Is(e, ErrRouteConflict) {
+		fmt.Println(fmt.Sprintf("conflicting url-pattern want ErrRouteConflict but got %v", e))
+		t.Fail()
+	}
+	if e := srv.RegisterService(&zeroTagService{}); !errors.Is(e, ErrRouteConflict) {
+		fmt.Println(fmt.Sprintf("messageID 0 by tag want ErrRouteConflict with zeroService but got %v", e))
+		t.Fail()
+	}
+	if e := srv.RegisterService(&sameMessageIDService{}); !errors.Is(e, ErrRouteConflict) {
+		fmt.Println(fmt.Sprintf("methods of the same messageID want ErrRouteConflict but got %v", e))
+		t.Fail()
+	}
+	if len(srv.Routes()) != routes {
+		fmt.Println(fmt.Sprintf("conflicting services should register nothing, routes %d -> %d", routes, len(srv.Routes())))
+		t.Fail()
+	}
+
+	if e := srv.RegisterServiceName("user/v2", &UserService{}); e == nil {
+		fmt.Println("service name with '/' should fail")
+		t.Fail()
+	}
+}
@@ -0,0 +1,352 @@
+package tcpx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+// ## introduction:
+// Stream is used to move bodies bigger than SetMaxBytePerMessage over the same connection.
+// A stream is a start frame, some data frames and an end frame sharing the same header 'Stream-ID'.
+// Sender side:
+/*
+   w := tcpx.NewStreamWriter(conn, 1, 32*tcpx.KB)
+   io.Copy(w, file)
+   w.Close()
+*/
+// Receiver side, handler of messageID 1 is called once the start frame arrives:
+/*
+   srv.AddHandler(1, func(c *tcpx.Context){
+       r, e := c.StreamReader()
+       if e != nil {
+           return
+       }
+       io.Copy(dst, r)
+   })
+*/
+// Data frames are buffered by at most DEFAULT_STREAM_BUFFER_CHUNKS chunks per stream. When the handler reads slower than
+// the sender writes, reading of the connection pauses and tcp flow control slows down the sender, so memory stays bounded.
+// Data frames not read when the handler chain returns are discarded.
+// A start frame reusing the Stream-ID of an unfinished stream aborts the old one, its reader returns ErrStreamAborted.
+
+const (
+	FRAME_STREAM_START = "stream-start"
+	FRAME_STREAM_DATA  = "stream-data"
+	FRAME_STREAM_END   = "stream-end"
+
+	DEFAULT_STREAM_CHUNK_SIZE    = 32 * 1024
+	DEFAULT_STREAM_BUFFER_CHUNKS = 16
+)
+
+var streamIDSeed int64
+
+// returned by StreamReader.Read when sender closes the stream with an error
+var ErrStreamAborted = errors.New("stream aborted by sender")
+
+// StreamWriter splits what is written into data frames.
+// Start frame is sent before the first data frame, end frame is sent by Close.
+type StreamWriter struct {
+	w         io.Writer
+	messageID int32
+	header    map[string]interface{}
+	streamID  string
+	chunkSize int
+
+	buf     []byte
+	started bool
+	closed  bool
+}
+
+// New a stream writer. w can be a net.Conn or any writer whose other end reads tcpx frames.
+// chunkSize <= 0 uses DEFAULT_STREAM_CHUNK_SIZE, it should be smaller than the receiver's max byte per message.
+// headers are put into the start frame, routing headers like 'Router-Type' should be put here.
+func NewStreamWriter(w io.Writer, messageID int32, chunkSize int, headers ...map[string]interface{}) *StreamWriter {
+	if chunkSize <= 0 {
+		chunkSize = DEFAULT_STREAM_CHUNK_SIZE
+	}
+	return &StreamWriter{
+		w:         w,
+		messageID: messageID,
+		header:    mergeHeaders(headers),
+		streamID:  strconv.FormatInt(atomic.AddInt64(&streamIDSeed, 1), 10),
+		chunkSize: chunkSize,
+		buf:       make([]byte, 0, chunkSize),
+	}
+}
+
+// StreamID of the stream
+func (sw *StreamWriter) StreamID() string {
+	return sw.streamID
+}
+
+// Write buffers p and sends it as data frames of chunkSize.
+func (sw *StreamWriter) Write(p []byte) (int, error) {
+	if sw.closed {
+		return 0, errors.New("write on closed stream")
+	}
+	var n int
+	for len(p) > 0 {
+		space := sw.chunkSize - len(sw.buf)
+		if space > len(p) {
+			space = len(p)
+		}
+		sw.buf = append(sw.buf, p[:space]...)
+		p = p[space:]
+		n += space
+		if len(sw.buf) == sw.chunkSize {
+			if e := sw.flush(); e != nil {
+				return n, e
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close sends the rest buffered bytes and the end frame.
+func (sw *StreamWriter) Close() error {
+	return sw.CloseWithError(nil)
+}
+
+// CloseWithError sends the rest buffered bytes and an end frame telling the receiver the stream is broken.
+// Receiver's reader will return ErrStreamAborted.
+func (sw *StreamWriter) CloseWithError(reason error) error {
+	if sw.closed {
+		return nil
+	}
+	if e := sw.flush(); e != nil {
+		return e
+	}
+	sw.closed = true
+
+	var header = map[string]interface{}{
+		HEADER_FRAME_TYPE: FRAME_STREAM_END,
+		HEADER_STREAM_ID:  sw.streamID,
+	}
+	if reason != nil {
+		header[HEADER_STREAM_ABORT] = reason.Error()
+	}
+	return sw.writeFrame(header, nil)
+}
+
+func (sw *StreamWriter) flush() error {
+	if !sw.started {
+		var header = make(map[string]interface{}, len(sw.header)+2)
+		for k, v := range sw.header {
+			header[k] = v
+		}
+		header[HEADER_FRAME_TYPE] = FRAME_STREAM_START
+		header[HEADER_STREAM_ID] = sw.streamID
+		if e := sw.writeFrame(header, nil); e != nil {
+			return e
+		}
+		sw.started = true
+	}
+	if len(sw.buf) == 0 {
+		return nil
+	}
+	e := sw.writeFrame(map[string]interface{}{
+		HEADER_FRAME_TYPE: FRAME_STREAM_DATA,
+		HEADER_STREAM_ID:  sw.streamID,
+	}, sw.buf)
+	sw.buf = sw.buf[:0]
+	return e
+}
+
+func (sw *StreamWriter) writeFrame(header map[string]interface{}, body []byte) error {
+	buf, e := PackWithMarshallerAndBody(Message{MessageID: sw.messageID, Header: header}, body)
+	if e != nil {
+		return errorx.Wrap(e)
+	}
+	for len(buf) > 0 {
+		n, e := sw.w.Write(buf)
+		if e != nil {
+			return e
+		}
+		buf = buf[n:]
+	}
+	return nil
+}
+
+// StreamReader reads data of an incoming stream, it returns io.EOF after the end frame.
+type StreamReader struct {
+	streamID string
+	chunks   chan []byte
+	abandon  chan struct{}
+	once     *sync.Once
+	connEnd  <-chan int
+
+	current []byte
+	abort   string
+	aborted bool
+}
+
+func newStreamReader(streamID string, connEnd <-chan int) *StreamReader {
+	return &StreamReader{
+		streamID: streamID,
+		chunks:   make(chan []byte, DEFAULT_STREAM_BUFFER_CHUNKS),
+		abandon:  make(chan struct{}),
+		once:     &sync.Once{},
+		connEnd:  connEnd,
+	}
+}
+
+// StreamID of the stream
+func (sr *StreamReader) StreamID() string {
+	return sr.streamID
+}
+
+// Read returns io.ErrUnexpectedEOF when connection is closed before the end frame arrives.
+func (sr *StreamReader) Read(p []byte) (int, error) {
+	for len(sr.current) == 0 {
+		var chunk []byte
+		var ok bool
+		select {
+		case chunk, ok = <-sr.chunks:
+		case <-sr.connEnd:
+			// buffered chunks are still readable
+			select {
+			case chunk, ok = <-sr.chunks:
+			default:
+				return 0, io.ErrUnexpectedEOF
+			}
+		}
+		if !ok {
+			if sr.aborted {
+				return 0, fmt.Errorf("%w: %s", ErrStreamAborted, sr.abort)
+			}
+			return 0, io.EOF
+		}
+		sr.current = chunk
+	}
+	n := copy(p, sr.current)
+	sr.current = sr.current[n:]
+	return n, nil
+}
+
+// called by connection reading loop, blocks when buffer is full unless the reader is abandoned or connection is closed.
+func (sr *StreamReader) feed(chunk []byte) {
+	select {
+	case sr.chunks <- chunk:
+	case <-sr.abandon:
+	case <-sr.connEnd:
+	}
+}
+
+func (sr *StreamReader) end(abort string, aborted bool) {
+	sr.abort = abort
+	sr.aborted = aborted
+	close(sr.chunks)
+}
+
+// discard rest data frames, called when handler chain is over or connection is closed.
+func (sr *StreamReader) discard() {
+	sr.once.Do(func() {
+		close(sr.abandon)
+	})
+}
+
+// incoming streams of a connection, keyed by stream id
+type streamTable struct {
+	l       *sync.Mutex
+	readers map[string]*StreamReader
+	connEnd <-chan int
+}
+
+func newStreamTable(connEnd <-chan int) *streamTable {
+	return &streamTable{
+		l:       &sync.Mutex{},
+		readers: make(map[string]*StreamReader),
+		connEnd: connEnd,
+	}
+}
+
+func (st *streamTable) open(streamID string) *StreamReader {
+	st.l.Lock()
+	defer st.l.Unlock()
+	// an unfinished stream of the same id would never get its end frame, end it so that its reader doesn't block forever
+	if old, ok := st.readers[streamID]; ok {
+		Logger.Println(errorx.NewFromStringf("stream '%s' reopened before it ends, the old one is aborted", streamID).Error())
+		old.end("stream reopened by sender", true)
+		old.discard()
+	}
+	sr := newStreamReader(streamID, st.connEnd)
+	st.readers[streamID] = sr
+	return sr
+}
+
+func (st *streamTable) get(streamID string) *StreamReader {
+	st.l.Lock()
+	defer st.l.Unlock()
+	return st.readers[streamID]
+}
+
+func (st *streamTable) remove(streamID string) {
+	st.l.Lock()
+	defer st.l.Unlock()
+	delete(st.readers, streamID)
+}
+
+func (st *streamTable) discardAll() {
+	st.l.Lock()
+	defer st.l.Unlock()
+	for k, v := range st.readers {
+		v.discard()
+		delete(st.readers, k)
+	}
+}
+
+// Route a stream frame read from connection.
+// Returns whether the frame is a data or end frame, which is consumed here and should not go to handlers.
+// Start frames get a reader set on ctx and still go to handlers.
+func (st *streamTable) route(ctx *Context, header map[string]interface{}) (bool, error) {
+	frameType, _, e := headerGetString(header, HEADER_FRAME_TYPE)
+	if e != nil {
+		return false, errorx.Wrap(e)
+	}
+	switch frameType {
+	case FRAME_STREAM_START, FRAME_STREAM_DATA, FRAME_STREAM_END:
+	default:
+		return false, nil
+	}
+
+	streamID, _, e := headerGetString(header, HEADER_STREAM_ID)
+	if e != nil {
+		return false, errorx.Wrap(e)
+	}
+	if streamID == "" {
+		return false, errorx.NewFromStringf("%s frame requires header '%s'", frameType, HEADER_STREAM_ID)
+	}
+
+	switch frameType {
+	case FRAME_STREAM_START:
+		ctx.streamReader = st.open(streamID)
+		return false, nil
+	case FRAME_STREAM_DATA:
+		sr := st.get(streamID)
+		if sr == nil {
+			Logger.Println(errorx.NewFromStringf("stream '%s' not found, data frame dropped", streamID).Error())
+			return true, nil
+		}
+		body, e := BodyBytesOf(ctx.Stream)
+		if e != nil {
+			return true, errorx.Wrap(e)
+		}
+		sr.feed(body)
+		return true, nil
+	default:
+		sr := st.get(streamID)
+		if sr == nil {
+			return true, nil
+		}
+		st.remove(streamID)
+		abort, aborted, _ := headerGetString(header, HEADER_STREAM_ABORT)
+		sr.end(abort, aborted)
+		return true, nil
+	}
+}
@@ -0,0 +1,180 @@
+package tcpx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+func TestStreamWriter_Frames(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewStreamWriter(&buf, 5, 4, map[string]interface{}{"file": "a.txt"})
+	w.Write([]byte("0123456789"))
+	w.CloseWithError(errors.New("disk broken"))
+
+	var frameTypes []string
+	var table = newStreamTable(make(chan int))
+	var reader *StreamReader
+	var received = make(chan []byte, 1)
+	for {
+		block, e := FirstBlockOf(&buf)
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			t.Fatal(e.Error())
+		}
+		header, _ := HeaderOf(block)
+		frameType, _, _ := headerGetString(header, HEADER_FRAME_TYPE)
+		frameTypes = append(frameTypes, frameType)
+
+		ctx := &Context{Stream: block}
+		consumed, e := table.route(ctx, header)
+		if e != nil {
+			t.Fatal(e.Error())
+		}
+		if frameType == FRAME_STREAM_START {
+			if consumed || ctx.streamReader == nil {
+				t.Fatal("start frame should go to handlers with a stream reader")
+			}
+			if header["file"] != "a.txt" {
+				t.Fatal("start frame should carry user headers")
+			}
+			reader = ctx.streamReader
+			go func() {
+				b, e := ioutil.ReadAll(reader)
+				if !errors.Is(e, ErrStreamAborted) {
+					fmt.Println(fmt.Sprintf("read aborted stream want ErrStreamAborted but got %v", e))
+					t.Fail()
+				}
+				received <- b
+			}()
+		}
+	}
+
+	// start, 3 data frames of 4,4,2 bytes, end
+	if len(frameTypes) != 5 || frameTypes[0] != FRAME_STREAM_START || frameTypes[4] != FRAME_STREAM_END {
+		fmt.Println(fmt.Sprintf("unexpected frames %v", frameTypes))
+		t.Fail()
+	}
+	if b := <-received; string(b) != "0123456789" {
+		fmt.Println(fmt.Sprintf("stream want '0123456789' but got '%s'", b))
+		t.Fail()
+	}
+}
+
+func TestTcpX_Stream(t *testing.T) {
+	var serverStart = make(chan int, 1)
+	var testResult = make(chan error, 1)
+
+	var payload = bytes.Repeat([]byte("tcpx-stream-"), 400*1024)
+	var sum = sha256.Sum256(payload)
+
+	// client
+	go func() {
+		<-serverStart
+
+		conn, e := net.Dial("tcp", "localhost:7011")
+		if e != nil {
+			testResult <- errorx.Wrap(e)
+			return
+		}
+		w := NewStreamWriter(conn, 1, 16*KB)
+		if _, e := io.Copy(w, bytes.NewReader(payload)); e != nil {
+			testResult <- errorx.Wrap(e)
+			return
+		}
+		if e := w.Close(); e != nil {
+			testResult <- errorx.Wrap(e)
+			return
+		}
+
+		reply, e := FirstBlockOf(conn)
+		if e != nil {
+			testResult <- errorx.Wrap(e)
+			return
+		}
+		var got []byte
+		if _, e := PackJSON.Unpack(reply, &got); e != nil {
+			testResult <- errorx.Wrap(e)
+			return
+		}
+		if !bytes.Equal(got, sum[:]) {
+			testResult <- errorx.NewFromString("stream received by server is not the same as sent")
+			return
+		}
+		testResult <- nil
+	}()
+
+	// server
+	go func() {
+		srv := NewTcpX(JsonMarshaller{})
+		// much smaller than the payload
+		srv.SetMaxBytePerMessage(int32(64 * KB))
+		srv.AddHandler(1, func(c *Context) {
+			r, e := c.StreamReader()
+			if e != nil {
+				testResult <- errorx.Wrap(e)
+				return
+			}
+			h := sha256.New()
+			if _, e := io.Copy(h, r); e != nil {
+				testResult <- errorx.Wrap(e)
+				return
+			}
+			c.Reply(2, h.Sum(nil))
+		})
+		go func() {
+			time.Sleep(time.Second)
+			serverStart <- 1
+		}()
+		if e := srv.ListenAndServe("tcp", ":7011"); e != nil {
+			testResult <- errorx.Wrap(e)
+		}
+	}()
+
+	select {
+	case e := <-testResult:
+		if e != nil {
+			fmt.Println(e.Error())
+			t.Fail()
+		}
+	case <-time.After(20 * time.Second):
+		fmt.Println("stream test time out")
+		t.Fail()
+	}
+}
+
+func TestStreamTable_Reopen(t *testing.T) {
+	var table = newStreamTable(make(chan int))
+	old := table.open("1")
+	var result = make(chan error, 1)
+	go func() {
+		_, e := ioutil.ReadAll(old)
+		result <- e
+	}()
+
+	sr := table.open("1")
+	select {
+	case e := <-result:
+		if !errors.Is(e, ErrStreamAborted) {
+			fmt.Println(fmt.Sprintf("reader of reopened stream want ErrStreamAborted but got %v", e))
+			t.Fail()
+		}
+	case <-time.After(2 * time.Second):
+		fmt.Println("reader of reopened stream blocks")
+		t.Fail()
+	}
+	if table.get("1") != sr {
+		fmt.Println("stream id should refer to the new reader")
+		t.Fail()
+	}
+}
@@ -11,8 +11,6 @@ import (
 	"os/signal"
 	"reflect"
 	"runtime/debug"
-	"strconv"
-	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -27,8 +25,6 @@ const (
 
 	STATE_RUNNING = 1
 	STATE_STOP    = 2
-
-	PIPED = "[tcpx-buffer-in-serial]"
 )
 
 // OnMessage and mux are opposite.
@@ -48,6 +44,8 @@ type TcpX struct {
 
 	// max limit
 	maxByte int32
+	// limits of header and body of frames received
+	frameLimits FrameLimits
 
 	// heartbeat setting
 	HeartBeatOn        bool          // whether start a goroutine to spy on each connection
@@ -93,6 +91,13 @@ type TcpX struct {
 	// tls
 	// If you want your tcp server using certs, using this field
 	TLSConfig *tls.Config
+
+	// application-layer session encryption, see secure.go.
+	// when secureSession is set true by `srv.WithSecureSession(true, psk)`, each tcp connection must finish
+	// an ecdh handshake before OnConnect, and all frames after it are sealed.
+	secureSession    bool
+	preSharedKey     []byte
+	HandshakeTimeout time.Duration
 }
 
 type PropertyCache struct {
@@ -130,7 +135,19 @@ func (tcpx *TcpX) WithAuthDetail(yes bool, duration time.Duration, throughMiddle
 	tcpx.AuthThroughMiddleware = throughMiddleware
 
 	if yes {
-		tcpx.AddHandler(messageID, f)
+		tcpx.addHandler(messageID, f)
+	}
+	return tcpx
+}
+
+// Whether using application-layer session encryption.
+// preSharedKey is optional, when set, clients must call `tcpx.SecureClient(conn, preSharedKey)` with the same key.
+// Only tcp server supports it.
+func (tcpx *TcpX) WithSecureSession(yes bool, preSharedKey []byte) *TcpX {
+	tcpx.secureSession = yes
+	tcpx.preSharedKey = preSharedKey
+	if tcpx.HandshakeTimeout == 0 {
+		tcpx.HandshakeTimeout = 10 * time.Second
 	}
 	return tcpx
 }
@@ -204,7 +221,7 @@ func (tcpx *TcpX) HeartBeatMode(on bool, duration time.Duration) *TcpX {
 	tcpx.HeartBeatMessageID = DEFAULT_HEARTBEAT_MESSAGEID
 
 	if on {
-		tcpx.AddHandler(DEFAULT_HEARTBEAT_MESSAGEID, func(c *Context) {
+		tcpx.addHandler(DEFAULT_HEARTBEAT_MESSAGEID, func(c *Context) {
 			Logger.Println(fmt.Sprintf("recv '%s' heartbeat:", c.ClientIP()), c.Stream)
 			c.RecvHeartBeat()
 		})
@@ -224,7 +241,7 @@ func (tcpx *TcpX) HeartBeatModeDetail(on bool, duration time.Duration, throughMi
 	tcpx.HeartBeatMessageID = messageID
 
 	if on {
-		tcpx.AddHandler(messageID, func(c *Context) {
+		tcpx.addHandler(messageID, func(c *Context) {
 			Logger.Println(fmt.Sprintf("recv '%s' heartbeat:", c.ClientIP()), c.Stream)
 			c.RecvHeartBeat()
 		})
@@ -239,15 +256,14 @@ func (tcpx *TcpX) HeartBeatModeDetail(on bool, duration time.Duration, throughMi
 func (tcpx *TcpX) RewriteHeartBeatHandler(messageID int32, f func(c *Context)) *TcpX {
 	tcpx.removeHandler(tcpx.HeartBeatMessageID)
 	tcpx.HeartBeatMessageID = messageID
-	tcpx.AddHandler(messageID, f)
+	tcpx.addHandler(messageID, f)
 	return tcpx
 }
 
 // remove a handler by messageID.
 // this method is used for rewrite heartbeat handler
 func (tcpx *TcpX) removeHandler(messageID int32) {
-	delete(tcpx.Mux.Handlers, messageID)
-	delete(tcpx.Mux.MessageIDAnchorMap, messageID)
+	tcpx.RemoveHandler(messageID)
 }
 
 // Middleware typed 'AnchorTypedMiddleware'.
@@ -278,11 +294,14 @@ func (tcpx *TcpX) Use(mids ...interface{}) {
 			panic(errorx.NewFromStringf("tcpx.Use(mids ...), 'mids' index '%d' should be func(c *tcpx.Context) type but got %s", j, reflect.TypeOf(mids[j]).Kind().String()))
 		}
 
-		middlewareAnchor, ok := tcpx.Mux.MiddlewareAnchorMap[middlewareKey]
+		middlewareAnchor, ok := tcpx.Mux.middlewareAnchor(middlewareKey)
 		if ok {
 			middlewareAnchor.callUse(tcpx.Mux.CurrentAnchorIndex())
-			tcpx.Mux.MiddlewareAnchorMap[middlewareKey] = middlewareAnchor
+			tcpx.Mux.ReplaceMiddlewareAnchor(middlewareAnchor)
 		} else {
+			if tcpx.Mux.whenMiddlewareExists(middlewareKey) {
+				panic(errorx.NewFromStringf("middlewareKey '%s' is added by UseWhen", middlewareKey))
+			}
 			var middlewareAnchor MiddlewareAnchor
 			middlewareAnchor.Middleware = middleware
 			middlewareAnchor.MiddlewareKey = middlewareKey
@@ -307,7 +326,7 @@ func (tcpx *TcpX) UnUse(middlewareKeys ...string) {
 	var middlewareAnchor MiddlewareAnchor
 	var ok bool
 	for _, k := range middlewareKeys {
-		if middlewareAnchor, ok = tcpx.Mux.MiddlewareAnchorMap[k]; !ok {
+		if middlewareAnchor, ok = tcpx.Mux.middlewareAnchor(k); !ok {
 			panic(errorx.NewFromStringf("middlewareKey '%s' not found in mux.MiddlewareAnchorMap", k))
 		}
 		middlewareAnchor.callUnUse(tcpx.Mux.CurrentAnchorIndex())
@@ -326,39 +345,40 @@ func (tcpx *TcpX) UseGlobal(mids ...func(c *Context)) {
 
 // Middleware typed 'SelfRelatedTypedMiddleware'.
 // Add handlers routing by messageID
+// messageIDs in [RESERVED_MESSAGEID_MIN, RESERVED_MESSAGEID_MAX] are rejected, they're reserved for framework messages.
+// Handlers made by WhenHeader make it a conditional route, see WhenHeader.
 func (tcpx *TcpX) AddHandler(messageID int32, handlers ...func(ctx *Context)) {
-	if len(handlers) <= 0 {
-		panic(errorx.NewFromStringf("handlers should more than 1 but got %d", len(handlers)))
+	if IsReservedMessageID(messageID) {
+		panic(reservedMessageIDError(messageID))
 	}
-	if len(handlers) > 1 {
-		tcpx.Mux.AddMessageIDSelfMiddleware(messageID, handlers[:len(handlers)-1]...)
+	if matchers, rest := splitMatchers(handlers); len(matchers) > 0 {
+		tcpx.When(matchers...).AddHandler(messageID, rest...)
+		return
 	}
+	tcpx.addHandler(messageID, handlers...)
+}
 
-	f := handlers[len(handlers)-1]
+// add handlers without checking reserved messageIDs, for framework messages like heartbeat and auth.
+func (tcpx *TcpX) addHandler(messageID int32, handlers ...func(ctx *Context)) {
+	if len(handlers) <= 0 {
+		panic(errorx.NewFromStringf("handlers should more than 1 but got %d", len(handlers)))
+	}
 	if tcpx.Mux == nil {
 		tcpx.Mux = NewMux()
 	}
-	tcpx.Mux.AddHandleFunc(messageID, f)
-	var messageIDAnchor = NewMessageIDAnchor(messageID, tcpx.Mux.CurrentAnchorIndex())
-	tcpx.Mux.AddMessageIDAnchor(messageIDAnchor)
+	tcpx.Mux.addMessageIDRoute(messageID, tcpx.Mux.CurrentAnchorIndex(), handlers)
 }
 
 func (tcpx *TcpX) Any(urlPattern string, handlers ...func(ctx *Context)) {
 	if len(handlers) <= 0 {
 		panic(errorx.NewFromStringf("handlers should more than 1 but got %d", len(handlers)))
 	}
-	if len(handlers) > 1 {
-		tcpx.Mux.urlMux.AddURLPatternHandler(urlPattern, handlers...)
+	if tcpx.Mux == nil {
+		tcpx.Mux = NewMux()
+	}
+	if e := tcpx.Mux.addURLRoute(urlPattern, tcpx.Mux.CurrentAnchorIndex(), handlers); e != nil {
+		panic(e)
 	}
-
-	//f := handlers[len(handlers)-1]
-	//if tcpx.Mux == nil {
-	//	tcpx.Mux = NewMux()
-	//}
-	//tcpx.Mux.AddHandleFunc(messageID, f)
-	tcpx.Mux.Any(urlPattern, handlers...)
-	var messageIDAnchor = NewUrlPatternAnchor(urlPattern, tcpx.Mux.CurrentAnchorIndex())
-	tcpx.Mux.AddURLAnchor(messageIDAnchor)
 }
 
 // Start to listen.
@@ -366,6 +386,15 @@ func (tcpx *TcpX) Any(urlPattern string, handlers ...func(ctx *Context)) {
 // Support tcp and udp
 func (tcpx *TcpX) ListenAndServe(network, addr string) error {
 	tcpx.checkPrepare()
+	// publish routes registered so far, so that the first frame doesn't wait for it
+	if tcpx.Mux != nil {
+		tcpx.Mux.routes()
+	}
+
+	if Logger.Mode == DEBUG && len(tcpx.Routes()) > 0 {
+		fmt.Println(fmt.Sprintf("[tcpx] routes of %s %s:", network, addr))
+		tcpx.PrintRoutes(os.Stdout)
+	}
 
 	if In(network, []string{"tcp", "tcp4", "tcp6", "unix", "unixpacket"}) {
 		return tcpx.ListenAndServeTCP(network, addr)
@@ -528,84 +557,115 @@ func (tcpx *TcpX) ListenAndServeTCP(network, addr string) error {
 		conn.SetReadDeadline(tcpx.readDeadLine)
 		conn.SetWriteDeadline(tcpx.writeDeadLine)
 
-		ctx := NewContext(conn, tcpx.Packx.Marshaller)
+		go tcpx.serveTCPConn(conn)
+	}
+	return nil
+}
 
-		if tcpx.builtInPool {
-			ctx.poolRef = tcpx.pool
+// Handle an accepted tcp connection in its own goroutine.
+// When secure session is on, handshake is done here so that a slow client can't block accepting.
+func (tcpx *TcpX) serveTCPConn(conn net.Conn) {
+	defer func() {
+		if e := recover(); e != nil {
+			Logger.Println(fmt.Sprintf("recover from panic %v", e))
+			// Logger.Println(string(debug.Stack()))
 		}
+	}()
 
-		if tcpx.OnConnect != nil {
-			tcpx.OnConnect(ctx)
+	if tcpx.secureSession {
+		secureConn, e := SecureServer(conn, tcpx.preSharedKey, tcpx.HandshakeTimeout)
+		if e != nil {
+			Logger.Println(fmt.Sprintf("secure handshake with '%s' fail: %s", conn.RemoteAddr().String(), e.Error()))
+			conn.Close()
+			return
 		}
+		// handshake resets deadline, put the configured ones back
+		conn.SetDeadline(tcpx.deadLine)
+		conn.SetReadDeadline(tcpx.readDeadLine)
+		conn.SetWriteDeadline(tcpx.writeDeadLine)
+		conn = secureConn
+	}
 
-		if tcpx.withSignals {
-			go broadcastSignalWatch(ctx, tcpx)
-		}
+	ctx := NewContext(conn, tcpx.Packx.Marshaller)
 
-		if tcpx.HeartBeatOn {
-			go heartBeatWatch(ctx, tcpx)
-		}
-		if tcpx.auth {
-			go authWatch(ctx, tcpx)
-		}
+	if tcpx.builtInPool {
+		ctx.poolRef = tcpx.pool
+	}
 
-		go func(ctx *Context, tcpx *TcpX) {
-			defer func() {
-				if e := recover(); e != nil {
-					Logger.Println(fmt.Sprintf("recover from panic %v", e))
-					// Logger.Println(string(debug.Stack()))
-				}
-			}()
-			//defer ctx.Conn.Close()
-			defer ctx.CloseConn()
-			if tcpx.OnClose != nil {
-				defer tcpx.OnClose(ctx)
-			}
-			var e error
-			for {
-				ctx.Stream, e = ctx.Packx.FirstBlockOfLimitMaxByte(ctx.Conn, tcpx.maxByte)
-				if e != nil {
-					if e == io.EOF {
-						break
-					}
-					Logger.Println(e)
-					break
-				}
-				tmpContext := copyContext(*ctx)
+	if tcpx.OnConnect != nil {
+		tcpx.OnConnect(ctx)
+	}
 
-				isPipe, restN, e := isPipe(tmpContext.Stream)
-				if e != nil {
-					Logger.Println(e)
-					break
-				}
-				// fmt.Println("pipe args", isPipe, restN)
-
-				if isPipe {
-					// fmt.Println("recv pipe", isPipe, restN)
-					ctxs := make([]*Context, restN+1)
-					ctxs[0] = tmpContext
-					for i := 1; i < restN+1; i++ {
-						ctx.Stream, e = ctx.Packx.FirstBlockOfLimitMaxByte(ctx.Conn, tcpx.maxByte)
-						if e != nil {
-							if e == io.EOF {
-								break
-							}
-							Logger.Println(e)
-							break
-						}
-						tmpContext := copyContext(*ctx)
-						ctxs[i] = tmpContext
-					}
+	if tcpx.withSignals {
+		go broadcastSignalWatch(ctx, tcpx)
+	}
 
-					go handlePipe(ctxs, tcpx)
-				} else {
-					go handleMiddleware(tmpContext, tcpx)
-				}
+	if tcpx.HeartBeatOn {
+		go heartBeatWatch(ctx, tcpx)
+	}
+	if tcpx.auth {
+		go authWatch(ctx, tcpx)
+	}
+
+	//defer ctx.Conn.Close()
+	defer ctx.CloseConn()
+	if tcpx.OnClose != nil {
+		defer tcpx.OnClose(ctx)
+	}
+	defer ctx.streams.discardAll()
+	var e error
+	for {
+		ctx.Stream, e = ctx.Packx.FirstBlockOfLimitMaxByte(ctx.Conn, tcpx.maxByte, tcpx.frameLimits)
+		if e != nil {
+			if e == io.EOF {
+				break
+			}
+			var le *LimitError
+			if errors.As(e, &le) && le.Discarded && tcpx.frameLimits.Reject {
+				Logger.Println(fmt.Sprintf("frame from '%s' rejected: %s", ctx.ClientIP(), le.Error()))
+				replyLimitError(ctx, le)
 				continue
 			}
-		}(ctx, tcpx)
+			if errors.Is(e, ErrFrameTooLarge) || errors.Is(e, ErrFrameTooShort) {
+				Logger.Println(fmt.Sprintf("bad frame from '%s', connection closed: %s", ctx.ClientIP(), e.Error()))
+				break
+			}
+			Logger.Println(e)
+			break
+		}
+		tmpContext := copyContext(*ctx)
+
+		header, e := HeaderOf(tmpContext.Stream)
+		if e != nil {
+			// frame boundary is still right, only this frame is dropped
+			if errors.Is(e, ErrHeaderMalformed) {
+				Logger.Println(fmt.Sprintf("frame from '%s' dropped: %s", ctx.ClientIP(), e.Error()))
+				continue
+			}
+			Logger.Println(e)
+			break
+		}
+		// matchers and predicates read it instead of parsing the frame again
+		tmpContext.setStreamHeader(header)
+		if ctx.calls.deliver(header, tmpContext.Stream) {
+			continue
+		}
+		consumed, e := ctx.streams.route(tmpContext, header)
+		if e != nil {
+			Logger.Println(e)
+			break
+		}
+		if consumed {
+			continue
+		}
+
+		if frameType, _, _ := headerGetString(header, HEADER_FRAME_TYPE); frameType == FRAME_BATCH {
+			go handleBatch(tmpContext, tcpx, header)
+			continue
+		}
+
+		go handleMiddleware(tmpContext, tcpx)
 	}
-	return nil
 }
 
 // set srv state running
@@ -851,6 +911,22 @@ func (tcpx *TcpX) ListenAndServeGRPC(network, addr string) error {
 //
 // However, this method is not open export for outer uset. When rebuild new protocol server, this will be considerately used.
 func handleMiddleware(ctx *Context, tcpx *TcpX) {
+	// after hooks see the error of panic
+	defer ctx.runAfters()
+	defer func() {
+		if e := recover(); e != nil {
+			Logger.Println(fmt.Sprintf("recover from handler panic %v", e))
+			ctx.Error(fmt.Errorf("handler panic: %v", e))
+			if ctx.batch != nil {
+				ctx.batch.panicked = true
+			}
+			ctx.autoReplyError(SERVER_ERROR, errInternal)
+		}
+	}()
+	if ctx.streamReader != nil {
+		defer ctx.streamReader.discard()
+	}
+
 	if tcpx.OnMessage != nil {
 		handleOnMessage(ctx, tcpx)
 		return
@@ -875,10 +951,9 @@ func handleOnMessage(ctx *Context, tcpx *TcpX) {
 	if ctx.handlers == nil {
 		ctx.handlers = make([]func(c *Context), 0, 10)
 	}
-	ctx.handlers = append(ctx.handlers, tcpx.Mux.GlobalMiddlewares...)
-	for _, v := range tcpx.Mux.MiddlewareAnchors {
-		ctx.handlers = append(ctx.handlers, v.Middleware)
-	}
+	rt := tcpx.Mux.routes()
+	ctx.handlers = append(ctx.handlers, rt.globals...)
+	ctx.handlers = append(ctx.handlers, rt.allAnchorMiddlewares()...)
 	ctx.handlers = append(ctx.handlers, tcpx.OnMessage)
 	if len(ctx.handlers) > 0 {
 		ctx.Next()
@@ -894,9 +969,10 @@ func handleMessageIDHandlers(ctx *Context, tcpx *TcpX) {
 		return
 	}
 
-	handler, ok := tcpx.Mux.Handlers[messageID]
+	rt := tcpx.Mux.routes()
+	handler, selfMiddlewares, anchorIndex, ok := rt.messageIDRoute(ctx, messageID)
 	if !ok {
-		Logger.Println(fmt.Sprintf("messageID %d handler not found", messageID))
+		handleNoRoute(ctx, rt, rt.noMessageID)
 		return
 	}
 	if messageID == tcpx.HeartBeatMessageID && !tcpx.ThroughMiddleware {
@@ -914,9 +990,8 @@ func handleMessageIDHandlers(ctx *Context, tcpx *TcpX) {
 	}
 
 	// global middleware
-	ctx.handlers = append(ctx.handlers, tcpx.Mux.GlobalMiddlewares...)
+	ctx.handlers = append(ctx.handlers, rt.globals...)
 	// anchor middleware
-	messageIDAnchorIndex := tcpx.Mux.AnchorIndexOfMessageID(messageID)
 	// ######## BUG REPORT ########
 	// old: anchor type middleware may be added unordered.
 	// ############################
@@ -925,16 +1000,13 @@ func handleMessageIDHandlers(ctx *Context, tcpx *TcpX) {
 	//		ctx.handlers = append(ctx.handlers, v.Middleware)
 	//	}
 	//}
-	// new:
-	for i, _ := range tcpx.Mux.MiddlewareAnchors {
-		v := tcpx.Mux.MiddlewareAnchors[i]
-		if v.Contains(messageIDAnchorIndex) {
-			ctx.handlers = append(ctx.handlers, v.Middleware)
-		}
-	}
+	// new: in order of anchors
+	ctx.handlers = append(ctx.handlers, rt.anchorMiddlewares(anchorIndex)...)
+	// conditional middleware
+	ctx.handlers = appendWhenHandlers(ctx.handlers, rt.messageIDWhens[messageID])
 
 	// self-related middleware
-	ctx.handlers = append(ctx.handlers, tcpx.Mux.MessageIDSelfMiddleware[messageID]...)
+	ctx.handlers = append(ctx.handlers, selfMiddlewares...)
 	// handler
 	ctx.handlers = append(ctx.handlers, handler)
 
@@ -946,15 +1018,16 @@ func handleMessageIDHandlers(ctx *Context, tcpx *TcpX) {
 
 // messageID router will be handled here
 func handleURLPatternHandlers(ctx *Context, tcpx *TcpX) {
-	urlPattern, e := URLPatternOf(ctx.Stream)
+	url, e := URLPatternOf(ctx.Stream)
 	if e != nil {
 		Logger.Println(errorx.Wrap(e).Error())
 		return
 	}
 
-	handlers, ok := tcpx.Mux.urlMux.urlPatternMux[urlPattern]
+	rt := tcpx.Mux.routes()
+	urlPattern, handlers, params, ok := rt.matchURL(url)
 	if !ok {
-		Logger.Println(fmt.Sprintf("urlPattern %s handler not found", urlPattern))
+		handleNoRoute(ctx, rt, rt.noRoute)
 		return
 	}
 	//if messageID == tcpx.HeartBeatMessageID && !tcpx.ThroughMiddleware {
@@ -967,21 +1040,18 @@ func handleURLPatternHandlers(ctx *Context, tcpx *TcpX) {
 	//	return
 	//}
 
+	ctx.params = params
+
 	if ctx.handlers == nil {
 		ctx.handlers = make([]func(c *Context), 0, 10)
 	}
 
 	// global middleware
-	ctx.handlers = append(ctx.handlers, tcpx.Mux.GlobalMiddlewares...)
+	ctx.handlers = append(ctx.handlers, rt.globals...)
 	// anchor middleware
-	urlPatternHandlerAnchorIndex := tcpx.Mux.AnchorIndexOfURLPattern(urlPattern)
-
-	for i, _ := range tcpx.Mux.MiddlewareAnchors {
-		v := tcpx.Mux.MiddlewareAnchors[i]
-		if v.Contains(urlPatternHandlerAnchorIndex) {
-			ctx.handlers = append(ctx.handlers, v.Middleware)
-		}
-	}
+	ctx.handlers = append(ctx.handlers, rt.anchorMiddlewares(rt.urlAnchors[urlPattern])...)
+	// conditional middleware
+	ctx.handlers = appendWhenHandlers(ctx.handlers, rt.urlWhens[urlPattern])
 
 	ctx.handlers = append(ctx.handlers, handlers...)
 
@@ -991,21 +1061,13 @@ func handleURLPatternHandlers(ctx *Context, tcpx *TcpX) {
 	ctx.Reset()
 }
 
-func handlePipe(ctxs []*Context, tcpx *TcpX) {
-	// fmt.Println("handle pipe ", len(ctxs))
-	for i, _ := range ctxs {
-		handleMiddleware(ctxs[i], tcpx)
-	}
-}
-
 func handleRaw(ctx *Context, tcpx *TcpX) {
 	if ctx.handlers == nil {
 		ctx.handlers = make([]func(c *Context), 0, 10)
 	}
-	ctx.handlers = append(ctx.handlers, tcpx.Mux.GlobalMiddlewares...)
-	for _, v := range tcpx.Mux.MiddlewareAnchors {
-		ctx.handlers = append(ctx.handlers, v.Middleware)
-	}
+	rt := tcpx.Mux.routes()
+	ctx.handlers = append(ctx.handlers, rt.globals...)
+	ctx.handlers = append(ctx.handlers, rt.allAnchorMiddlewares()...)
 	ctx.handlers = append(ctx.handlers, tcpx.HandleRaw)
 	if len(ctx.handlers) > 0 {
 		ctx.Next()
@@ -1123,7 +1185,7 @@ func (tcpx *TcpX) BeforeExit(f ...func()) {
 				fmt.Println(fmt.Sprintf("panic from %v", e))
 			}
 		}()
-		ch := make(chan os.Signal)
+		ch := make(chan os.Signal, 1)
 		signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL, syscall.SIGQUIT)
 		fmt.Println("receive signal:", <-ch)
 		fmt.Println("prepare to stop server")
@@ -1194,7 +1256,7 @@ func (tcpx *TcpX) Start() error {
 	}
 
 	for _, v := range tcpx.properties {
-		go func() {
+		go func(v *PropertyCache) {
 			defer func() {
 				if e := recover(); e != nil {
 					Logger.Println(fmt.Sprintf("panic from '%v' \n %s", e, debug.Stack()))
@@ -1205,7 +1267,7 @@ func (tcpx *TcpX) Start() error {
 			if e != nil {
 				Logger.Println(fmt.Sprintf("%s \n %s", e.Error(), debug.Stack()))
 			}
-		}()
+		}(v)
 	}
 	return nil
 }
@@ -1226,43 +1288,6 @@ func (tcpx *TcpX) Restart(closeAllConnection bool, beforeStart ...func()) error
 	return nil
 }
 
-// return isPipe, rest serial block number, error
-func isPipe(block []byte) (bool, int, error) {
-	header, e := HeaderOf(block)
-	if e != nil {
-		return false, 0, errorx.Wrap(e)
-	}
-	// fmt.Println("header: ", header)
-
-	if len(header) == 0 {
-		return false, 0, nil
-	}
-
-	pipeArgsI, ok := header[PIPED]
-	if !ok {
-		return false, 0, nil
-	}
-
-	pipeArgs, ok := pipeArgsI.(string)
-	if !ok {
-		return false, 0, errorx.NewFromStringf("bad pipe args, should format as a  string, bug got type '%s'", reflect.TypeOf(pipeArgsI).Name())
-	}
-
-	arr := strings.Split(pipeArgs, ";")
-	if len(arr) != 2 {
-		return false, 0, errorx.NewFromStringf("bad pipe args, should format as 'enable:<length>' but got %s", pipeArgs)
-	}
-
-	length, err := strconv.Atoi(arr[1])
-	if err != nil {
-		return false, 0, errorx.NewFromStringf("bad pipe args length, should format as 'enable:<length>' but got %s,\n %v", arr[1], err)
-	}
-	if arr[0] == "enable" {
-		return true, length - 1, nil
-	}
-	return false, 0, nil
-}
-
 // certPath and keyPath is dir path where cert.pem and key.pem is put
 func (tcpx *TcpX) LoadTLSFile(certPath string, keyPath string) error {
 	cer, e := tls.LoadX509KeyPair(certPath, keyPath)
@@ -0,0 +1,234 @@
+package tcpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+// ## introduction:
+// Register the body type of a route once, and frames of the route are decoded without switching messageID by hand:
+/*
+   tcpx.RegisterType(1, LoginReq{})
+   tcpx.RegisterReplyType(1, LoginResp{})
+   tcpx.RegisterType("/user/:id/profile", &pb.ProfileReq{})
+
+   srv.AddHandler(1, func(c *tcpx.Context) {
+       body, e := c.Body()
+       if e != nil {
+           return
+       }
+       req := body.(LoginReq)
+   })
+
+   message, e := client.CallAny(ctx, 1, LoginReq{})
+   resp := message.Body.(LoginResp)
+*/
+// Body has the same type as the prototype, a value for a value, and a pointer for a pointer(protobuf requires pointer).
+// Route of a frame is its url when header 'Router-Type' is URL_PATTERN, otherwise its messageID.
+// Urls are matched to registered url-patterns the same as routing, so '/user/42/profile' has the type of '/user/:id/profile'.
+// Requests and replies have separate types, since a reply often goes by the same route as its request.
+// Frames marked by header 'Is-Reply' use types registered by RegisterReplyType, others use types registered by RegisterType.
+
+// returned by ctx.Body() when no type is registered for the route
+var ErrTypeNotRegistered = errors.New("tcpx: type not registered")
+
+// types of routes, of requests or of replies
+type typeTable struct {
+	messageIDs map[int32]reflect.Type
+	urls       map[string]reflect.Type
+	// url-patterns registered, to match urls of frames
+	urlTree *urlTree
+}
+
+func newTypeTable() *typeTable {
+	return &typeTable{
+		messageIDs: make(map[int32]reflect.Type),
+		urls:       make(map[string]reflect.Type),
+		urlTree:    newURLTree(),
+	}
+}
+
+var types = struct {
+	l        *sync.RWMutex
+	requests *typeTable
+	replies  *typeTable
+}{
+	l:        &sync.RWMutex{},
+	requests: newTypeTable(),
+	replies:  newTypeTable(),
+}
+
+// Register type of prototype for requests of route, which is a messageID(int32 or int) or an url-pattern(string).
+// A registered route will be replaced.
+func RegisterType(route interface{}, prototype interface{}) {
+	registerType(types.requests, "RegisterType", route, prototype)
+}
+
+// Register type of prototype for replies of route, the same as RegisterType.
+func RegisterReplyType(route interface{}, prototype interface{}) {
+	registerType(types.replies, "RegisterReplyType", route, prototype)
+}
+
+func registerType(tt *typeTable, caller string, route interface{}, prototype interface{}) {
+	if prototype == nil {
+		panic(fmt.Sprintf("tcpx: %s requires a prototype", caller))
+	}
+	t := reflect.TypeOf(prototype)
+
+	types.l.Lock()
+	defer types.l.Unlock()
+	switch v := route.(type) {
+	case int32:
+		tt.messageIDs[v] = t
+	case int:
+		tt.messageIDs[int32(v)] = t
+	case string:
+		tt.urlTree.insert(v)
+		tt.urls[v] = t
+	default:
+		panic(fmt.Sprintf("tcpx: %s requires route of messageID or url-pattern, but got %T", caller, route))
+	}
+}
+
+// Type registered for requests of route by RegisterType, route is a messageID or an url.
+func RegisteredType(route interface{}) (reflect.Type, bool) {
+	return registeredType(types.requests, route)
+}
+
+// Type registered for replies of route by RegisterReplyType, route is a messageID or an url.
+func RegisteredReplyType(route interface{}) (reflect.Type, bool) {
+	return registeredType(types.replies, route)
+}
+
+func registeredType(tt *typeTable, route interface{}) (reflect.Type, bool) {
+	types.l.RLock()
+	defer types.l.RUnlock()
+	var t reflect.Type
+	switch v := route.(type) {
+	case int32:
+		t = tt.messageIDs[v]
+	case int:
+		t = tt.messageIDs[int32(v)]
+	case string:
+		if pattern, _, ok := tt.urlTree.match(v); ok {
+			t = tt.urls[pattern]
+		}
+	}
+	return t, t != nil
+}
+
+// type registered for the route of stream, of replies when stream is a reply
+func typeOfStream(stream []byte) (reflect.Type, bool) {
+	header, e := HeaderOf(stream)
+	if e != nil {
+		return nil, false
+	}
+	var tt = types.requests
+	if isReply, _ := header[HEADER_IS_REPLY].(bool); isReply {
+		tt = types.replies
+	}
+	if routerType, _, _ := headerGetString(header, HEADER_ROUTER_KEY); routerType == URLPATTERN {
+		url, _, e := headerGetString(header, HEADER_ROUTER_VALUE)
+		if e != nil {
+			return nil, false
+		}
+		return registeredType(tt, url)
+	}
+	messageID, e := MessageIDOf(stream)
+	if e != nil {
+		return nil, false
+	}
+	return registeredType(tt, messageID)
+}
+
+// DecodeAny unpacks stream into the type registered for its route, of replies when it's a reply, by the marshaller named in header 'Pack-Content-Type',
+// json when the header is not set.
+// When no type is registered, message.Body is the body bytes, so that tools and logging can still print it.
+func DecodeAny(stream []byte) (Message, error) {
+	return decodeAny(stream, JsonMarshaller{})
+}
+
+// UnpackAny is the same as DecodeAny, but packx.Marshaller is used when header 'Pack-Content-Type' is not set.
+func (packx Packx) UnpackAny(stream []byte) (Message, error) {
+	return decodeAny(stream, packx.Marshaller)
+}
+
+func decodeAny(stream []byte, defaultMarshaller Marshaller) (Message, error) {
+	t, ok := typeOfStream(stream)
+	if !ok {
+		messageID, e := MessageIDOf(stream)
+		if e != nil {
+			return Message{}, e
+		}
+		header, e := HeaderOf(stream)
+		if e != nil {
+			return Message{}, e
+		}
+		body, e := BodyBytesOf(stream)
+		if e != nil {
+			return Message{}, e
+		}
+		return Message{MessageID: messageID, Header: header, Body: body}, nil
+	}
+
+	marshaller, e := MarshallerOf(stream, defaultMarshaller)
+	if e != nil {
+		return Message{}, e
+	}
+	var dest reflect.Value
+	if t.Kind() == reflect.Ptr {
+		dest = reflect.New(t.Elem())
+	} else {
+		dest = reflect.New(t)
+	}
+	message, e := UnpackWithMarshaller(stream, dest.Interface(), marshaller)
+	if e != nil {
+		return Message{}, e
+	}
+	if t.Kind() == reflect.Ptr {
+		message.Body = dest.Interface()
+	}
+	return message, nil
+}
+
+// Body of ctx.Stream decoded into the type registered for its route, see RegisterType.
+// It returns ErrTypeNotRegistered when no type is registered. The decoded body is cached, calling it again costs nothing.
+func (ctx *Context) Body() (interface{}, error) {
+	if ctx.body != nil {
+		return ctx.body, nil
+	}
+	if _, ok := typeOfStream(ctx.Stream); !ok {
+		return nil, ErrTypeNotRegistered
+	}
+	message, e := decodeAny(ctx.Stream, ctx.Packx.Marshaller)
+	if e != nil {
+		return nil, e
+	}
+	ctx.body = message.Body
+	return ctx.body, nil
+}
+
+// CallAny is the same as Call, but the reply is decoded into the type registered by RegisterReplyType, see DecodeAny.
+func (client *Client) CallAny(ctx context.Context, messageID int32, req interface{}, headers ...map[string]interface{}) (Message, error) {
+	var message = Message{MessageID: messageID, Header: mergeHeaders(headers), Body: req}
+	reply, e := client.roundTrip(ctx, func(requestID string) ([]byte, error) {
+		message.Header[HEADER_REQUEST_ID] = requestID
+		return message.Pack(client.Packx.Marshaller)
+	})
+	if e != nil {
+		return Message{}, e
+	}
+	if se := StatusErrorOf(reply); se != nil {
+		return Message{}, se
+	}
+	replyMessage, e := client.Packx.UnpackAny(reply)
+	if e != nil {
+		return Message{}, errorx.Wrap(e)
+	}
+	return replyMessage, nil
+}
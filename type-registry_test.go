@@ -0,0 +1,100 @@
+package tcpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type registryReq struct {
+	Username string `json:"username" msgpack:"username"`
+}
+type registryResp struct {
+	Greeting string `json:"greeting" msgpack:"greeting"`
+}
+
+func TestDecodeAny(t *testing.T) {
+	RegisterType(int32(3001), registryReq{})
+	RegisterType("/registry/decode/", &registryReq{})
+
+	buf, _ := PackWithMarshaller(Message{MessageID: 3001, Body: registryReq{Username: "tcpx"}}, MsgpackMarshaller{})
+	message, e := DecodeAny(buf)
+	if req, ok := message.Body.(registryReq); e != nil || !ok || req.Username != "tcpx" {
+		fmt.Println(fmt.Sprintf("messageID: want registryReq 'tcpx' but got %#v, %v", message.Body, e))
+		t.Fail()
+	}
+
+	buf, _ = NewURLPatternMessage("/registry/decode/", registryReq{Username: "tcpx"}).Pack(JsonMarshaller{})
+	message, e = DecodeAny(buf)
+	if req, ok := message.Body.(*registryReq); e != nil || !ok || req.Username != "tcpx" {
+		fmt.Println(fmt.Sprintf("url-pattern: want *registryReq 'tcpx' but got %#v, %v", message.Body, e))
+		t.Fail()
+	}
+
+	// urls match registered url-patterns
+	RegisterType("/registry/:id/profile", registryReq{})
+	buf, _ = NewURLPatternMessage("/registry/42/profile", registryReq{Username: "tcpx"}).Pack(JsonMarshaller{})
+	message, e = DecodeAny(buf)
+	if req, ok := message.Body.(registryReq); e != nil || !ok || req.Username != "tcpx" {
+		fmt.Println(fmt.Sprintf("url of param: want registryReq 'tcpx' but got %#v, %v", message.Body, e))
+		t.Fail()
+	}
+
+	// replies of the same messageID have their own type
+	RegisterReplyType(int32(3001), registryResp{})
+	buf, _ = PackWithMarshaller(Message{MessageID: 3001, Header: map[string]interface{}{HEADER_REQUEST_ID: "1", HEADER_IS_REPLY: true}, Body: registryResp{Greeting: "hi"}}, JsonMarshaller{})
+	message, e = DecodeAny(buf)
+	if resp, ok := message.Body.(registryResp); e != nil || !ok || resp.Greeting != "hi" {
+		fmt.Println(fmt.Sprintf("reply: want registryResp 'hi' but got %#v, %v", message.Body, e))
+		t.Fail()
+	}
+
+	buf, _ = PackWithMarshaller(Message{MessageID: 3002, Body: "unregistered"}, JsonMarshaller{})
+	message, e = DecodeAny(buf)
+	if body, ok := message.Body.([]byte); e != nil || !ok || string(body) != `"unregistered"` {
+		fmt.Println(fmt.Sprintf("unregistered: want body bytes but got %#v, %v", message.Body, e))
+		t.Fail()
+	}
+}
+
+func TestContext_Body(t *testing.T) {
+	RegisterType(3003, registryReq{})
+	RegisterReplyType(3004, registryResp{})
+
+	srv := NewTcpX(JsonMarshaller{})
+	srv.AddHandler(3003, func(c *Context) {
+		body, e := c.Body()
+		if e != nil {
+			c.ReplyError(CLIENT_ERROR, e)
+			return
+		}
+		c.Reply(3004, registryResp{Greeting: "hello " + body.(registryReq).Username})
+	})
+	srv.AddHandler(3005, func(c *Context) {
+		_, e := c.Body()
+		c.Reply(3005, errors.Is(e, ErrTypeNotRegistered))
+	})
+	go srv.ListenAndServe("tcp", ":7021")
+	time.Sleep(500 * time.Millisecond)
+
+	client, e := Dial("tcp", "localhost:7021", JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+	client.Timeout = 3 * time.Second
+
+	message, e := client.CallAny(context.Background(), 3003, registryReq{Username: "tcpx"})
+	if resp, ok := message.Body.(registryResp); e != nil || !ok || resp.Greeting != "hello tcpx" {
+		fmt.Println(fmt.Sprintf("want registryResp 'hello tcpx' but got %#v, %v", message.Body, e))
+		t.Fail()
+	}
+
+	var notRegistered bool
+	if e := client.Call(context.Background(), 3005, nil, &notRegistered); e != nil || !notRegistered {
+		fmt.Println(fmt.Sprintf("unregistered route should return ErrTypeNotRegistered, got %v", e))
+		t.Fail()
+	}
+}
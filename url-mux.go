@@ -3,7 +3,6 @@ package tcpx
 import (
 	"fmt"
 	"github.com/fwhezfwhez/errorx"
-	"runtime"
 )
 
 // ## introduction:
@@ -12,6 +11,14 @@ import (
     srv.Any("/bra/bra", func(c *tcpx.Context){})
 */
 // All usage about url-mux is alike messageID mux.
+// Patterns can have params and catch-alls, got by ctx.Param():
+/*
+    srv.Any("/user/:id/profile", func(c *tcpx.Context){
+        id := c.Param("id")
+    })
+    srv.Any("/static/*filepath", func(c *tcpx.Context){})
+*/
+// See urlTree for how a url is matched.
 
 // ## Why to design url-mux?
 // Since messageID style requires users to manage messageID themselves, it's kind of inconvenient for a team of many developers to manage conflicted messageIDs.
@@ -21,6 +28,8 @@ type URLMux struct {
 	// messageIDMux  map[int][]func(c *Context)
 	urlPatternMux map[string][]func(c *Context)
 	URLAnchorMap  map[string]MessageIDAnchor
+	// patterns of urlPatternMux, matching urls to patterns
+	tree *urlTree
 
 	readOnly bool
 
@@ -32,6 +41,7 @@ type URLMux struct {
 func NewURLMux() *URLMux {
 	return &URLMux{
 		urlPatternMux: make(map[string][]func(c *Context)),
+		tree:          newURLTree(),
 
 		urlRouteInfo: make(map[string]Route),
 	}
@@ -40,9 +50,8 @@ func NewURLMux() *URLMux {
 // 基于url-pattern添加路由
 func (m *URLMux) AddURLPatternHandler(urlPattern string, handlers ... func(c *Context)) error {
 	if m.readOnly == false {
-		_, file, line, _ := runtime.Caller(1)
 		routeInfo := Route{
-			Whereis:    []string{fmt.Sprintf("%s:%d", file, line)},
+			Whereis:    []string{callerLocation()},
 			URLPattern: urlPattern,
 		}
 
@@ -54,6 +63,7 @@ func (m *URLMux) AddURLPatternHandler(urlPattern string, handlers ... func(c *Co
 
 			m.urlPatternMux[urlPattern] = append(h, handlers...)
 		} else {
+			m.tree.insert(urlPattern)
 			m.urlPatternMux[urlPattern] = handlers
 		}
 
@@ -69,6 +79,16 @@ func (m *URLMux) AddURLPatternHandler(urlPattern string, handlers ... func(c *Co
 	}
 }
 
+// remove a pattern and rebuild the tree of the rest
+func (m *URLMux) remove(urlPattern string) {
+	delete(m.urlPatternMux, urlPattern)
+	delete(m.urlRouteInfo, urlPattern)
+	m.tree = newURLTree()
+	for k := range m.urlPatternMux {
+		m.tree.insert(k)
+	}
+}
+
 // MessageID和URL路由在添加时，如果已存在，则会panic。
 func (m *URLMux) PanicOnExistRouter() error {
 	if m.readOnly == false {
@@ -0,0 +1,189 @@
+package tcpx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// urlTree is a radix tree of url-patterns. Static parts sharing a prefix share nodes, and a pattern can have
+// - ':name', a param matching a non-empty segment up to next '/'
+// - '*name', a catch-all matching the rest of url, it must be the last part of a pattern
+/*
+   /user/:id/profile    matches /user/42/profile, id=42
+   /static/*filepath    matches /static/js/app.js, filepath=js/app.js
+*/
+// When a url matches many patterns, static parts win over params, and params win over catch-alls,
+// so '/user/me/profile' goes to '/user/me/profile' even though '/user/:id/profile' exists.
+type urlTree struct {
+	root *urlNode
+}
+
+type urlNode struct {
+	// static bytes of the node, empty for root, param and catch-all nodes
+	prefix string
+
+	// static children, they never share the first byte
+	children []*urlNode
+	// ':name' child
+	param *urlNode
+	// '*name' child
+	catchAll *urlNode
+	// name of param or catch-all
+	name string
+
+	// pattern ending at the node
+	pattern string
+}
+
+// a param of url, got by ctx.Param(key)
+type urlParam struct {
+	Key   string
+	Value string
+}
+
+func newURLTree() *urlTree {
+	return &urlTree{root: &urlNode{}}
+}
+
+// insert pattern into tree, it panics when pattern is malformed or its params conflict with others.
+func (t *urlTree) insert(pattern string) {
+	n := t.root
+	for i := 0; i < len(pattern); {
+		switch pattern[i] {
+		case ':', '*':
+			end := i + 1
+			for end < len(pattern) && pattern[end] != '/' {
+				end++
+			}
+			name := pattern[i+1 : end]
+			if name == "" {
+				panic(fmt.Sprintf("tcpx: url-pattern '%s' has a param without name", pattern))
+			}
+			if pattern[i] == '*' {
+				if end != len(pattern) {
+					panic(fmt.Sprintf("tcpx: url-pattern '%s' has catch-all '*%s' not at the end", pattern, name))
+				}
+				n = n.child(&n.catchAll, name, pattern)
+			} else {
+				n = n.child(&n.param, name, pattern)
+			}
+			i = end
+		default:
+			end := i
+			for end < len(pattern) && pattern[end] != ':' && pattern[end] != '*' {
+				end++
+			}
+			n = n.insertStatic(pattern[i:end])
+			i = end
+		}
+	}
+	n.pattern = pattern
+}
+
+// get or create a param or catch-all child
+func (n *urlNode) child(ptr **urlNode, name string, pattern string) *urlNode {
+	if *ptr == nil {
+		*ptr = &urlNode{name: name}
+	}
+	if (*ptr).name != name {
+		panic(fmt.Sprintf("tcpx: param '%s' of url-pattern '%s' conflicts with '%s' registered at the same place", name, pattern, (*ptr).name))
+	}
+	return *ptr
+}
+
+// insert static s under n, splitting a child whose prefix partly matches s, and returns the node where s ends.
+func (n *urlNode) insertStatic(s string) *urlNode {
+	for s != "" {
+		var c *urlNode
+		for _, v := range n.children {
+			if v.prefix[0] == s[0] {
+				c = v
+				break
+			}
+		}
+		if c == nil {
+			c = &urlNode{prefix: s}
+			n.children = append(n.children, c)
+			return c
+		}
+
+		l := commonPrefixLength(c.prefix, s)
+		if l < len(c.prefix) {
+			// split c into c.prefix[:l] and its child c.prefix[l:]
+			tail := *c
+			tail.prefix = c.prefix[l:]
+			*c = urlNode{prefix: c.prefix[:l], children: []*urlNode{&tail}}
+		}
+		n, s = c, s[l:]
+	}
+	return n
+}
+
+func commonPrefixLength(a, b string) int {
+	var i int
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// match url and returns the pattern matched and params of url.
+func (t *urlTree) match(url string) (string, []urlParam, bool) {
+	var params []urlParam
+	if n := t.root.match(url, &params); n != nil {
+		return n.pattern, params, true
+	}
+	return "", nil, false
+}
+
+func (n *urlNode) match(url string, params *[]urlParam) *urlNode {
+	if url == "" && n.pattern != "" {
+		return n
+	}
+
+	// static first
+	if url != "" {
+		for _, c := range n.children {
+			if strings.HasPrefix(url, c.prefix) {
+				if m := c.match(url[len(c.prefix):], params); m != nil {
+					return m
+				}
+				break
+			}
+		}
+	}
+
+	// then param
+	if n.param != nil {
+		end := strings.IndexByte(url, '/')
+		if end == -1 {
+			end = len(url)
+		}
+		if end > 0 {
+			l := len(*params)
+			*params = append(*params, urlParam{Key: n.param.name, Value: url[:end]})
+			if m := n.param.match(url[end:], params); m != nil {
+				return m
+			}
+			*params = (*params)[:l]
+		}
+	}
+
+	// catch-all at last
+	if n.catchAll != nil && n.catchAll.pattern != "" {
+		*params = append(*params, urlParam{Key: n.catchAll.name, Value: url})
+		return n.catchAll
+	}
+	return nil
+}
+
+// Param returns value of a param in url-pattern, like 'id' of '/user/:id/profile'.
+// It returns empty string when the param is not found.
+func (ctx *Context) Param(key string) string {
+	for _, v := range ctx.params {
+		if v.Key == key {
+			return v.Value
+		}
+	}
+	return ""
+}
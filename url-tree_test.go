@@ -0,0 +1,110 @@
+package tcpx
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestURLTree(t *testing.T) {
+	tree := newURLTree()
+	for _, pattern := range []string{
+		"/user/:id/profile",
+		"/user/me/profile",
+		"/user/:id",
+		"/user/",
+		"/users/",
+		"/static/*filepath",
+		"/static/index",
+		"/game/:room/*rest",
+	} {
+		tree.insert(pattern)
+	}
+
+	var cases = []struct {
+		url     string
+		pattern string
+		params  map[string]string
+	}{
+		{"/user/42/profile", "/user/:id/profile", map[string]string{"id": "42"}},
+		{"/user/me/profile", "/user/me/profile", nil},
+		{"/user/me", "/user/:id", map[string]string{"id": "me"}},
+		{"/user/", "/user/", nil},
+		{"/users/", "/users/", nil},
+		{"/static/index", "/static/index", nil},
+		{"/static/js/app.js", "/static/*filepath", map[string]string{"filepath": "js/app.js"}},
+		{"/static/", "/static/*filepath", map[string]string{"filepath": ""}},
+		{"/game/1/a/b", "/game/:room/*rest", map[string]string{"room": "1", "rest": "a/b"}},
+		{"/user/42/settings", "", nil},
+		{"/use", "", nil},
+		{"/user//profile", "", nil},
+	}
+	for _, v := range cases {
+		pattern, params, ok := tree.match(v.url)
+		if v.pattern == "" {
+			if ok {
+				fmt.Println(fmt.Sprintf("'%s' should match nothing but got '%s'", v.url, pattern))
+				t.Fail()
+			}
+			continue
+		}
+		if !ok || pattern != v.pattern || len(params) != len(v.params) {
+			fmt.Println(fmt.Sprintf("'%s' want '%s' %v but got '%s' %v", v.url, v.pattern, v.params, pattern, params))
+			t.Fail()
+			continue
+		}
+		for _, p := range params {
+			if v.params[p.Key] != p.Value {
+				fmt.Println(fmt.Sprintf("'%s' want param %s=%s but got %s", v.url, p.Key, v.params[p.Key], p.Value))
+				t.Fail()
+			}
+		}
+	}
+
+	for _, pattern := range []string{"/user/:uid/profile", "/static/*path/x", "/bad/:"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					fmt.Println(fmt.Sprintf("'%s' should panic", pattern))
+					t.Fail()
+				}
+			}()
+			tree.insert(pattern)
+		}()
+	}
+}
+
+func TestContext_Param(t *testing.T) {
+	var calls int
+	srv := NewTcpX(JsonMarshaller{})
+	srv.Any("/user/:id/profile", func(c *Context) {
+		calls++
+	}, func(c *Context) {
+		c.JSONURLPattern(c.Param("id"))
+	})
+	srv.Any("/user/me/profile", func(c *Context) {
+		c.JSONURLPattern("me")
+	})
+	go srv.ListenAndServe("tcp", ":7022")
+	time.Sleep(500 * time.Millisecond)
+
+	client, e := Dial("tcp", "localhost:7022", JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+	client.Timeout = 3 * time.Second
+
+	for url, want := range map[string]string{"/user/42/profile": "42", "/user/me/profile": "me"} {
+		var got string
+		if e := client.CallURLPattern(context.Background(), url, nil, &got); e != nil || got != want {
+			fmt.Println(fmt.Sprintf("'%s' want '%s' but got '%s', %v", url, want, got, e))
+			t.Fail()
+		}
+	}
+	if calls != 1 {
+		fmt.Println(fmt.Sprintf("middleware should run once but ran %d times", calls))
+		t.Fail()
+	}
+}
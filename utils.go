@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/BurntSushi/toml"
 	"io"
+	"math"
 	"net"
 	"reflect"
 	"strings"
@@ -143,8 +144,10 @@ func BindJSON(bodyBuf []byte, dest interface{}) error {
 	return json.Unmarshal(bodyBuf, dest)
 }
 
+// Deprecated: use Batch, which supports any marshaller. PipeJSON packs args into a json batch and writes it to conn.
+// Server replies one batch-reply frame, read it by UnpackBatchReply.
+// args are in pair of messageID(int or int32) and data.
 func PipeJSON(conn net.Conn, args ...interface{}) error {
-
 	if len(args) == 0 {
 		return nil
 	}
@@ -153,48 +156,29 @@ func PipeJSON(conn net.Conn, args ...interface{}) error {
 		return errorx.NewFromString("iligal args, PipeJSON'args requires messageID int32, data interface{} in pair")
 	}
 
-	num := len(args) / 2
-
-	var allBuf = make([]byte, 0, 100)
-
+	batch := NewBatch(JsonMarshaller{})
 	for i := 0; i < len(args)-1; i += 2 {
-		messageID, ok := args[i].(int)
-		if !ok {
+		var messageID int32
+		switch v := args[i].(type) {
+		case int:
+			messageID = int32(v)
+		case int32:
+			messageID = v
+		default:
 			return errorx.NewFromStringf("wrong type, args[%d] should be a int type messageID but got %s", i, reflect.TypeOf(args[i]).Name())
 		}
-		message := args[i+1]
-
-		var msg Message
-		if i == 0 {
-			msg = Message{
-				MessageID: int32(messageID),
-				Header: map[string]interface{}{
-					PIPED: fmt.Sprintf("enable;%d", num),
-				},
-				Body: message,
-			}
-		} else {
-			msg = Message{
-				MessageID: int32(messageID),
-				Header:    nil,
-				Body:      message,
-			}
-		}
-
-		buf, e := PackWithMarshaller(msg, JsonMarshaller{})
-		if e != nil {
+		if e := batch.Add(messageID, args[i+1]); e != nil {
 			return errorx.Wrap(e)
 		}
-
-		allBuf = append(allBuf, buf...)
 	}
 
-	if len(allBuf) != 0 {
-		if _, e := conn.Write(allBuf); e != nil {
-			return errorx.Wrap(e)
-		}
+	buf, e := batch.Pack()
+	if e != nil {
+		return errorx.Wrap(e)
+	}
+	if _, e := conn.Write(buf); e != nil {
+		return errorx.Wrap(e)
 	}
-
 	return nil
 }
 
@@ -221,6 +205,17 @@ func TCPCallOnceJSON(network string, url string, messageID int, data interface{}
 	return nil
 }
 
+// merge optional headers into one, latter keys cover former ones
+func mergeHeaders(headers []map[string]interface{}) map[string]interface{} {
+	var header = make(map[string]interface{})
+	for _, v := range headers {
+		for k1, v1 := range v {
+			header[k1] = v1
+		}
+	}
+	return header
+}
+
 // get key-value from a header
 func headerGetString(header map[string]interface{}, key string) (string, bool, error) {
 	var exist bool
@@ -243,6 +238,40 @@ func headerGetString(header map[string]interface{}, key string) (string, bool, e
 	return value, exist, nil
 }
 
+// get int value from a header, numbers decoded from json header are float64.
+func headerGetInt(header map[string]interface{}, key string) (int, error) {
+	valueI, exist := header[key]
+	if !exist {
+		return 0, errorx.NewFromStringf("key '%s' not found", key)
+	}
+	value, e := intOf(valueI)
+	if e != nil {
+		return 0, errorx.NewFromStringf("key '%s': %s", key, e.Error())
+	}
+	return value, nil
+}
+
+func intOf(valueI interface{}) (int, error) {
+	switch v := valueI.(type) {
+	case int:
+		return v, nil
+	case int32:
+		return int(v), nil
+	case int64:
+		if int64(int(v)) != v {
+			return 0, fmt.Errorf("%v overflows int", v)
+		}
+		return int(v), nil
+	case float64:
+		// converting a float out of range is implementation-specific, check it first
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return 0, fmt.Errorf("%v is not an integer in range", v)
+		}
+		return intOf(int64(v))
+	}
+	return 0, fmt.Errorf("%v is not a number", valueI)
+}
+
 // Recv a block of message from connection.
 // To use this, it require sender sent message well packed by tcpx.Pack()
 func Recv(conn net.Conn) (PackType, error) {
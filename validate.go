@@ -0,0 +1,240 @@
+package tcpx
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ## introduction:
+// ctx.BindAndValidate binds the body and checks it by struct tags, typed handlers of Handle and HandleURLPattern do it too.
+/*
+   type LoginReq struct {
+       Username string `json:"username" validate:"required,max=32"`
+       Age      int    `json:"age" validate:"min=1,max=150"`
+       Platform string `json:"platform" validate:"omitempty,oneof=ios android"`
+   }
+
+   var req LoginReq
+   if _, e := c.BindAndValidate(&req); e != nil {
+       return
+   }
+*/
+// rules of TagValidator, separated by ',':
+// - required, value is not zero
+// - omitempty, skip other rules when value is zero
+// - min=n, max=n, numbers compare by value, strings, slices and maps compare by length
+// - len=n, length of string, slice or map
+// - oneof=a b c, value is one of the words
+// Nested structs and pointers to struct are checked too, field names are taken from json tag.
+//
+// A failure is *ValidationError. When the request carries 'Request-ID', an error frame of CLIENT_ERROR is replied automatically,
+// listing bad fields in header 'Error-Fields', and the client gets them by StatusError.Fields.
+// Replace the validator by SetValidator, for example an adapter of go-playground/validator.
+
+type Validator interface {
+	// Validate returns *ValidationError when v is invalid
+	Validate(v interface{}) error
+}
+
+// FieldError is a field failing a rule.
+type FieldError struct {
+	// path of the field, like 'profile.age'
+	Field string `json:"field"`
+	// the rule failed, like 'min=1'
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists all bad fields of a request.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (ve *ValidationError) Error() string {
+	var messages = make([]string, 0, len(ve.Fields))
+	for _, f := range ve.Fields {
+		messages = append(messages, f.Message)
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+var validator = struct {
+	l *sync.RWMutex
+	v Validator
+}{
+	l: &sync.RWMutex{},
+	v: TagValidator{},
+}
+
+// Replace the validator used by ctx.BindAndValidate and typed handlers. nil turns validation off.
+func SetValidator(v Validator) {
+	validator.l.Lock()
+	defer validator.l.Unlock()
+	validator.v = v
+}
+
+func getValidator() Validator {
+	validator.l.RLock()
+	defer validator.l.RUnlock()
+	return validator.v
+}
+
+// BindAndValidate binds body of ctx.Stream into dest like ctx.Bind, then validates dest.
+// When it fails, the request carries 'Request-ID' and the handler chain replies nothing, an error frame of CLIENT_ERROR is replied automatically.
+func (ctx *Context) BindAndValidate(dest interface{}) (Message, error) {
+	message, e := ctx.Bind(dest)
+	if e != nil {
+		return message, e
+	}
+	v := getValidator()
+	if v == nil {
+		return message, nil
+	}
+	if e := v.Validate(dest); e != nil {
+		ctx.autoReplyErrorUnlessReplied(CLIENT_ERROR, e)
+		return message, e
+	}
+	return message, nil
+}
+
+// TagValidator validates structs by tag 'validate', see rules above.
+type TagValidator struct {
+	// tag name, empty means 'validate'
+	TagName string
+}
+
+func (tv TagValidator) Validate(v interface{}) error {
+	var tagName = tv.TagName
+	if tagName == "" {
+		tagName = "validate"
+	}
+	var fields []FieldError
+	validateStruct(reflect.ValueOf(v), tagName, "", &fields)
+	if len(fields) != 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+func validateStruct(rv reflect.Value, tagName string, prefix string, fields *[]FieldError) {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return
+	}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name := fieldName(sf)
+		if name == "-" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		fv := rv.Field(i)
+		if tag := sf.Tag.Get(tagName); tag != "" && tag != "-" {
+			if fe, ok := checkRules(fv, name, tag); !ok {
+				*fields = append(*fields, fe)
+				continue
+			}
+		}
+		validateStruct(fv, tagName, name, fields)
+	}
+}
+
+// name of a field seen by clients
+func fieldName(sf reflect.StructField) string {
+	name := strings.Split(sf.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return sf.Name
+	}
+	return name
+}
+
+// check rules of a field, returns the first rule failed
+func checkRules(fv reflect.Value, name string, tag string) (FieldError, bool) {
+	rules := strings.Split(tag, ",")
+	zero := fv.IsZero()
+	for _, rule := range rules {
+		if rule == "omitempty" && zero {
+			return FieldError{}, true
+		}
+	}
+	for _, rule := range rules {
+		key, param := rule, ""
+		if i := strings.Index(rule, "="); i != -1 {
+			key, param = rule[:i], rule[i+1:]
+		}
+		var ok = true
+		var message string
+		switch key {
+		case "omitempty", "":
+		case "required":
+			ok = !zero
+			message = fmt.Sprintf("%s is required", name)
+		case "min", "max", "len":
+			ok, message = checkSize(fv, name, key, param)
+		case "oneof":
+			ok = In(fmt.Sprint(indirect(fv).Interface()), strings.Fields(param))
+			message = fmt.Sprintf("%s should be one of [%s]", name, param)
+		default:
+			panic(fmt.Sprintf("tcpx: unknown validate rule '%s' of field '%s'", rule, name))
+		}
+		if !ok {
+			return FieldError{Field: name, Rule: rule, Message: message}, false
+		}
+	}
+	return FieldError{}, true
+}
+
+func indirect(fv reflect.Value) reflect.Value {
+	for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+		fv = fv.Elem()
+	}
+	return fv
+}
+
+func checkSize(fv reflect.Value, name string, key string, param string) (bool, string) {
+	fv = indirect(fv)
+	n, e := strconv.ParseFloat(param, 64)
+	if e != nil {
+		panic(fmt.Sprintf("tcpx: validate rule '%s=%s' of field '%s' requires a number", key, param, name))
+	}
+
+	var got float64
+	var what = "length of " + name
+	switch fv.Kind() {
+	case reflect.String:
+		got = float64(len([]rune(fv.String())))
+	case reflect.Slice, reflect.Array, reflect.Map:
+		got = float64(fv.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		got, what = float64(fv.Int()), name
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		got, what = float64(fv.Uint()), name
+	case reflect.Float32, reflect.Float64:
+		got, what = fv.Float(), name
+	default:
+		return true, ""
+	}
+
+	switch key {
+	case "min":
+		return got >= n, fmt.Sprintf("%s should be at least %s", what, param)
+	case "max":
+		return got <= n, fmt.Sprintf("%s should be at most %s", what, param)
+	default:
+		return got == n, fmt.Sprintf("%s should be %s", what, param)
+	}
+}
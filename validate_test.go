@@ -0,0 +1,98 @@
+package tcpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type validateProfile struct {
+	Age int `json:"age" validate:"min=1,max=150"`
+}
+
+type validateReq struct {
+	Username string           `json:"username" validate:"required,max=8"`
+	Platform string           `json:"platform" validate:"omitempty,oneof=ios android"`
+	Tags     []string         `json:"tags" validate:"len=2"`
+	Profile  *validateProfile `json:"profile"`
+}
+
+func TestTagValidator(t *testing.T) {
+	var cases = []struct {
+		req    validateReq
+		fields []string
+	}{
+		{validateReq{Username: "tcpx", Tags: []string{"a", "b"}}, nil},
+		{validateReq{Username: "tcpx", Platform: "ios", Tags: []string{"a", "b"}, Profile: &validateProfile{Age: 20}}, nil},
+		{validateReq{Tags: []string{"a", "b"}}, []string{"username"}},
+		{validateReq{Username: "a very long name", Platform: "pc", Tags: []string{"a"}}, []string{"username", "platform", "tags"}},
+		{validateReq{Username: "tcpx", Tags: []string{"a", "b"}, Profile: &validateProfile{}}, []string{"profile.age"}},
+	}
+	for i, v := range cases {
+		e := TagValidator{}.Validate(&v.req)
+		var ve *ValidationError
+		if len(v.fields) == 0 {
+			if e != nil {
+				fmt.Println(fmt.Sprintf("case %d: want valid but got %v", i, e))
+				t.Fail()
+			}
+			continue
+		}
+		if !errors.As(e, &ve) || len(ve.Fields) != len(v.fields) {
+			fmt.Println(fmt.Sprintf("case %d: want bad fields %v but got %v", i, v.fields, e))
+			t.Fail()
+			continue
+		}
+		for j, f := range ve.Fields {
+			if f.Field != v.fields[j] {
+				fmt.Println(fmt.Sprintf("case %d: want bad field '%s' but got '%s'", i, v.fields[j], f.Field))
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestContext_BindAndValidate(t *testing.T) {
+	srv := NewTcpX(JsonMarshaller{})
+	srv.AddHandler(1, func(c *Context) {
+		var req validateReq
+		if _, e := c.BindAndValidate(&req); e != nil {
+			return
+		}
+		c.Reply(1, req.Username)
+	})
+	Handle(srv, 2, func(c *Context, req *validateReq) (*string, error) {
+		return &req.Username, nil
+	})
+	go srv.ListenAndServe("tcp", ":7020")
+	time.Sleep(500 * time.Millisecond)
+
+	client, e := Dial("tcp", "localhost:7020", JsonMarshaller{})
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer client.Close()
+	client.Timeout = 3 * time.Second
+
+	for _, messageID := range []int32{1, 2} {
+		var username string
+		if e := client.Call(context.Background(), messageID, validateReq{Username: "tcpx", Tags: []string{"a", "b"}}, &username); e != nil || username != "tcpx" {
+			fmt.Println(fmt.Sprintf("messageID %d: want 'tcpx' but got '%s', %v", messageID, username, e))
+			t.Fail()
+		}
+
+		var se *StatusError
+		e := client.Call(context.Background(), messageID, validateReq{Tags: []string{"a"}}, nil)
+		if !errors.As(e, &se) || se.Code != CLIENT_ERROR || len(se.Fields) != 2 {
+			fmt.Println(fmt.Sprintf("messageID %d: want CLIENT_ERROR with 2 bad fields but got %v", messageID, e))
+			t.Fail()
+			continue
+		}
+		if se.Fields[0].Field != "username" || se.Fields[0].Rule != "required" || se.Fields[1].Rule != "len=2" {
+			fmt.Println(fmt.Sprintf("messageID %d: bad fields not replied, got %+v", messageID, se.Fields))
+			t.Fail()
+		}
+	}
+}